@@ -92,24 +92,27 @@ func withoutFormatting(s string, lineNumberOneBased *int) string {
 		return s
 	}
 
-	stripped := strings.Builder{}
-	runeCount := 0
+	stripped := plainTextBuilder{}
 
 	// " * 2" here makes BenchmarkPlainTextSearch() perform 30% faster. Probably
 	// due to avoiding a number of additional implicit Grow() calls when adding
 	// runes.
-	stripped.Grow(len(s) * 2)
+	stripped.builder.Grow(len(s) * 2)
 
 	styledStringsFromString(s, lineNumberOneBased, func(str string, style twin.Style) {
 		for _, runeValue := range runesFromStyledString(_StyledString{String: str, Style: style}) {
+			if runeValue == '\r' && !rawCarriageReturns {
+				stripped.carriageReturn()
+				continue
+			}
+
 			switch runeValue {
 
 			case '\x09': // TAB
 				for {
-					stripped.WriteRune(' ')
-					runeCount++
+					stripped.write(' ')
 
-					if runeCount%_TabSize == 0 {
+					if stripped.cursor%_TabSize == 0 {
 						// We arrived at the next tab stop
 						break
 					}
@@ -117,26 +120,22 @@ func withoutFormatting(s string, lineNumberOneBased *int) string {
 
 			case '�': // Go's broken-UTF8 marker
 				if unprintableStyle == UNPRINTABLE_STYLE_HIGHLIGHT {
-					stripped.WriteRune('?')
+					stripped.write('?')
 				} else if unprintableStyle == UNPRINTABLE_STYLE_WHITESPACE {
-					stripped.WriteRune(' ')
+					stripped.write(' ')
 				} else {
 					panic(fmt.Errorf("Unsupported unprintable-style: %#v", unprintableStyle))
 				}
-				runeCount++
 
 			case BACKSPACE:
-				stripped.WriteRune('<')
-				runeCount++
+				stripped.write('<')
 
 			default:
 				if !twin.Printable(runeValue) {
-					stripped.WriteRune('?')
-					runeCount++
+					stripped.write('?')
 					continue
 				}
-				stripped.WriteRune(runeValue)
-				runeCount++
+				stripped.write(runeValue)
 			}
 		}
 	})
@@ -144,25 +143,95 @@ func withoutFormatting(s string, lineNumberOneBased *int) string {
 	return stripped.String()
 }
 
+// A line of cells being written, where carriage returns work like on a
+// terminal. After a carriage return, writing starts over from the beginning of
+// the line, overwriting what was there before.
+//
+// This makes progress output like "10%\r20%\r30%" show up as just "30%".
+type cellsBuilder struct {
+	cells []twin.Cell
+
+	// Where the next write goes
+	cursor int
+}
+
+func (builder *cellsBuilder) write(cell twin.Cell) {
+	if builder.cursor < len(builder.cells) {
+		builder.cells[builder.cursor] = cell
+	} else {
+		builder.cells = append(builder.cells, cell)
+	}
+	builder.cursor++
+}
+
+func (builder *cellsBuilder) carriageReturn() {
+	builder.cursor = 0
+}
+
+// Like cellsBuilder, but for plain text. Most lines have no carriage returns,
+// so we only start keeping track of individual runes after the first one.
+type plainTextBuilder struct {
+	builder strings.Builder
+
+	// Set on the first carriage return. After that, we write into runes
+	// rather than into builder.
+	overwriting bool
+	runes       []rune
+
+	// Where the next write goes, in runes
+	cursor int
+}
+
+func (plain *plainTextBuilder) write(char rune) {
+	if !plain.overwriting {
+		plain.builder.WriteRune(char)
+	} else if plain.cursor < len(plain.runes) {
+		plain.runes[plain.cursor] = char
+	} else {
+		plain.runes = append(plain.runes, char)
+	}
+	plain.cursor++
+}
+
+func (plain *plainTextBuilder) carriageReturn() {
+	if !plain.overwriting {
+		plain.overwriting = true
+		plain.runes = []rune(plain.builder.String())
+	}
+	plain.cursor = 0
+}
+
+func (plain *plainTextBuilder) String() string {
+	if !plain.overwriting {
+		return plain.builder.String()
+	}
+	return string(plain.runes)
+}
+
 // Turn a (formatted) string into a series of screen cells
 func cellsFromString(s string, lineNumberOneBased *int) cellsWithTrailer {
-	var cells []twin.Cell
+	cells := cellsBuilder{}
 
 	// Specs: https://en.wikipedia.org/wiki/ANSI_escape_code#3-bit_and_4-bit
 	styleUnprintable := twin.StyleDefault.WithBackground(twin.NewColor16(1)).WithForeground(twin.NewColor16(7))
 
 	trailer := styledStringsFromString(s, lineNumberOneBased, func(str string, style twin.Style) {
 		for _, token := range tokensFromStyledString(_StyledString{String: str, Style: style}) {
+			if token.Rune == '\r' && !rawCarriageReturns {
+				cells.carriageReturn()
+				continue
+			}
+
 			switch token.Rune {
 
 			case '\x09': // TAB
 				for {
-					cells = append(cells, twin.Cell{
+					cells.write(twin.Cell{
 						Rune:  ' ',
 						Style: style,
 					})
 
-					if (len(cells))%_TabSize == 0 {
+					if cells.cursor%_TabSize == 0 {
 						// We arrived at the next tab stop
 						break
 					}
@@ -170,12 +239,12 @@ func cellsFromString(s string, lineNumberOneBased *int) cellsWithTrailer {
 
 			case '�': // Go's broken-UTF8 marker
 				if unprintableStyle == UNPRINTABLE_STYLE_HIGHLIGHT {
-					cells = append(cells, twin.Cell{
+					cells.write(twin.Cell{
 						Rune:  '?',
 						Style: styleUnprintable,
 					})
 				} else if unprintableStyle == UNPRINTABLE_STYLE_WHITESPACE {
-					cells = append(cells, twin.Cell{
+					cells.write(twin.Cell{
 						Rune:  '?',
 						Style: twin.StyleDefault,
 					})
@@ -184,7 +253,7 @@ func cellsFromString(s string, lineNumberOneBased *int) cellsWithTrailer {
 				}
 
 			case BACKSPACE:
-				cells = append(cells, twin.Cell{
+				cells.write(twin.Cell{
 					Rune:  '<',
 					Style: styleUnprintable,
 				})
@@ -192,12 +261,12 @@ func cellsFromString(s string, lineNumberOneBased *int) cellsWithTrailer {
 			default:
 				if !twin.Printable(token.Rune) {
 					if unprintableStyle == UNPRINTABLE_STYLE_HIGHLIGHT {
-						cells = append(cells, twin.Cell{
+						cells.write(twin.Cell{
 							Rune:  '?',
 							Style: styleUnprintable,
 						})
 					} else if unprintableStyle == UNPRINTABLE_STYLE_WHITESPACE {
-						cells = append(cells, twin.Cell{
+						cells.write(twin.Cell{
 							Rune:  ' ',
 							Style: twin.StyleDefault,
 						})
@@ -206,13 +275,13 @@ func cellsFromString(s string, lineNumberOneBased *int) cellsWithTrailer {
 					}
 					continue
 				}
-				cells = append(cells, token)
+				cells.write(token)
 			}
 		}
 	})
 
 	return cellsWithTrailer{
-		Cells:   cells,
+		Cells:   cells.cells,
 		Trailer: trailer,
 	}
 }
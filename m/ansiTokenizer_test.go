@@ -3,6 +3,7 @@ package m
 import (
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
 	"testing"
 	"unicode/utf8"
@@ -267,3 +268,48 @@ func TestHyperlink_incomplete(t *testing.T) {
 		})
 	}
 }
+
+func TestCarriageReturns(t *testing.T) {
+	line := NewLine("Progress: 10%\rProgress: 50%\rDone")
+	assert.Equal(t, line.Plain(nil), "Doneress: 50%")
+	assert.Equal(t, rowToString(line.HighlightedTokens("", nil, nil).Cells), "Doneress: 50%")
+
+	// Windows line endings
+	line = NewLine("dos\r")
+	assert.Equal(t, line.Plain(nil), "dos")
+	assert.Equal(t, len(line.HighlightedTokens("", nil, nil).Cells), 3)
+
+	// Tab stops are counted from where we are after the carriage return
+	line = NewLine("abcdefgh\r\tX")
+	assert.Equal(t, line.Plain(nil), "    Xfgh")
+
+	// Styling is kept for what's written after the carriage return
+	cells := cellsFromString("abc\r\x1b[1mX", nil).Cells
+	assert.Equal(t, len(cells), 3)
+	assert.Equal(t, cells[0], twin.Cell{Rune: 'X', Style: twin.StyleDefault.WithAttr(twin.AttrBold)})
+	assert.Equal(t, cells[1], twin.Cell{Rune: 'b', Style: twin.StyleDefault})
+}
+
+func TestCarriageReturnsSearch(t *testing.T) {
+	line := NewLine("Progress: 10%\rProgress: 50%")
+	cells := line.HighlightedTokens("", regexp.MustCompile("50"), nil).Cells
+	assert.Equal(t, cells[10].Style, twin.StyleDefault.WithAttr(twin.AttrReverse))
+	assert.Equal(t, cells[11].Style, twin.StyleDefault.WithAttr(twin.AttrReverse))
+
+	// The overwritten text isn't on screen, so it shouldn't be found
+	assert.Assert(t, !regexp.MustCompile("10").MatchString(line.Plain(nil)))
+}
+
+func TestRawCarriageReturns(t *testing.T) {
+	rawCarriageReturns = true
+	t.Cleanup(func() {
+		rawCarriageReturns = false
+	})
+
+	line := NewLine("10%\r20%")
+	assert.Equal(t, line.Plain(nil), "10%?20%")
+
+	cells := line.HighlightedTokens("", nil, nil).Cells
+	assert.Equal(t, len(cells), 7)
+	assert.Equal(t, cells[3].Rune, '?')
+}
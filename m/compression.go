@@ -0,0 +1,225 @@
+package m
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+type compressionFormat struct {
+	name string
+
+	// Files in this format start with one of these byte sequences
+	magics [][]byte
+
+	// File name suffixes for this format, used for figuring out which
+	// highlighter to use for the decompressed contents
+	suffixes []string
+
+	// If the returned reader is an io.Closer, it must be closed after use
+	decompress func(io.Reader) (io.Reader, error)
+}
+
+var compressionFormats = []compressionFormat{
+	{
+		name:     "gzip",
+		magics:   [][]byte{{0x1f, 0x8b}},
+		suffixes: []string{".gz"},
+		decompress: func(compressed io.Reader) (io.Reader, error) {
+			return gzip.NewReader(compressed)
+		},
+	},
+	{
+		name:     "bzip2",
+		magics:   bzip2Magics(),
+		suffixes: []string{".bz2"},
+		decompress: func(compressed io.Reader) (io.Reader, error) {
+			return bzip2.NewReader(compressed), nil
+		},
+	},
+	{
+		name:     "xz",
+		magics:   [][]byte{{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+		suffixes: []string{".xz"},
+		decompress: func(compressed io.Reader) (io.Reader, error) {
+			return xz.NewReader(compressed)
+		},
+	},
+	{
+		name:     "zstd",
+		magics:   [][]byte{{0x28, 0xb5, 0x2f, 0xfd}},
+		suffixes: []string{".zst", ".zstd"},
+		decompress: func(compressed io.Reader) (io.Reader, error) {
+			// We read from a single stream, no need for more goroutines than
+			// that
+			decoder, err := zstd.NewReader(compressed, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+
+			// Closing stops the decoder's goroutines
+			return decoder.IOReadCloser(), nil
+		},
+	},
+	{
+		name:     "lz4",
+		magics:   [][]byte{{0x04, 0x22, 0x4d, 0x18}},
+		suffixes: []string{".lz4"},
+		decompress: func(compressed io.Reader) (io.Reader, error) {
+			return lz4.NewReader(compressed), nil
+		},
+	},
+	{
+		name:     "compress",
+		magics:   [][]byte{{0x1f, 0x9d}},
+		suffixes: []string{".Z"},
+		decompress: func(compressed io.Reader) (io.Reader, error) {
+			return newUnixCompressReader(compressed)
+		},
+	},
+}
+
+// "BZh" alone is too common a start of a text file, so we also require the
+// block size digit and the magic number of the first block. Empty files have
+// the end of stream magic number there instead.
+func bzip2Magics() [][]byte {
+	magics := [][]byte{}
+	for blockSize := '1'; blockSize <= '9'; blockSize++ {
+		for _, blockMagic := range []string{"1AY&SY", "\x17\x72\x45\x38\x50\x90"} {
+			magics = append(magics, []byte("BZh"+string(blockSize)+blockMagic))
+		}
+	}
+	return magics
+}
+
+// Figure out which compression format, if any, the stream is in.
+//
+// Bytes are peeked one at a time, and only as long as some format's magic
+// could still match. This way a slow uncompressed stream won't make us wait
+// for more input than the first byte.
+//
+// Returns nil if the stream isn't compressed, or if we can't tell.
+func sniffCompression(stream *bufio.Reader) *compressionFormat {
+	type candidate struct {
+		format *compressionFormat
+		magic  []byte
+	}
+
+	candidates := []candidate{}
+	for i := range compressionFormats {
+		for _, magic := range compressionFormats[i].magics {
+			candidates = append(candidates, candidate{&compressionFormats[i], magic})
+		}
+	}
+
+	for peekCount := 1; len(candidates) > 0; peekCount++ {
+		peeked, err := stream.Peek(peekCount)
+		if err != nil {
+			// Most likely EOF, meaning the stream is too short to be
+			// compressed
+			return nil
+		}
+
+		stillMatching := candidates[:0]
+		for _, candidate := range candidates {
+			if !bytes.HasPrefix(candidate.magic, peeked) {
+				continue
+			}
+
+			if len(candidate.magic) == len(peeked) {
+				return candidate.format
+			}
+
+			stillMatching = append(stillMatching, candidate)
+		}
+		candidates = stillMatching
+	}
+
+	return nil
+}
+
+// Wrap the stream in a decompressor if it is compressed, otherwise return the
+// stream as is.
+//
+// The format return value is nil if the stream isn't compressed. If the
+// returned reader is an io.Closer, it must be closed after use. That doesn't
+// close the stream.
+func decompress(stream io.Reader) (io.Reader, *compressionFormat, error) {
+	buffered := bufio.NewReader(stream)
+
+	format := sniffCompression(buffered)
+	if format == nil {
+		return buffered, nil, nil
+	}
+
+	decompressed, err := format.decompress(buffered)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return decompressed, format, nil
+}
+
+// Remove any compression suffix from a file name, so that "x.md.gz" becomes
+// "x.md".
+func (format *compressionFormat) stripSuffix(filename string) string {
+	for _, suffix := range format.suffixes {
+		if strings.HasSuffix(filename, suffix) {
+			return strings.TrimSuffix(filename, suffix)
+		}
+	}
+
+	return filename
+}
+
+// A decompressed file. Closing closes both the decompressor and the file.
+type decompressedFile struct {
+	io.Reader
+	file io.Closer
+}
+
+func (f decompressedFile) Close() error {
+	if closer, ok := f.Reader.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			_ = f.file.Close()
+			return err
+		}
+	}
+	return f.file.Close()
+}
+
+// An io.Reader that decompresses its input if needed.
+//
+// Figuring out whether the input is compressed is postponed until the first
+// Read(), so that creating one of these never blocks.
+type decompressingReader struct {
+	source       io.Reader
+	decompressed io.Reader
+}
+
+func (r *decompressingReader) Read(p []byte) (int, error) {
+	if r.decompressed == nil {
+		decompressed, _, err := decompress(r.source)
+		if err != nil {
+			return 0, err
+		}
+		r.decompressed = decompressed
+	}
+
+	return r.decompressed.Read(p)
+}
+
+// Close the decompressor, if any. The source stream is left open.
+func (r *decompressingReader) Close() error {
+	if closer, ok := r.decompressed.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package m
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	log "github.com/sirupsen/logrus"
+)
+
+// Interpreters whose names aren't known to Chroma
+var interpreterLanguages = map[string]string{
+	"node":   "javascript",
+	"nodejs": "javascript",
+	"deno":   "typescript",
+	"dash":   "bash",
+	"ash":    "bash",
+}
+
+// Recognizable first lines, lowercased, and their languages
+var firstLinePrefixes = []struct {
+	prefix   string
+	language string
+}{
+	{"<?xml", "xml"},
+	{"<!doctype html", "html"},
+	{"<html", "html"},
+	{"diff --git ", "diff"},
+}
+
+// "vim: set ft=python:", "vi: filetype=yaml"
+var vimModeline = regexp.MustCompile(`\b(?:vi|vim|ex):.*?\b(?:ft|filetype|syntax)=([\w+-]+)`)
+
+// "-*- mode: python -*-"
+var emacsModeline = regexp.MustCompile(`-\*-.*?\bmode:\s*([\w+-]+).*?-\*-`)
+
+// "-*- python -*-"
+var emacsShortModeline = regexp.MustCompile(`-\*-\s*([\w+-]+)\s*-\*-`)
+
+// Trailing version numbers of interpreters, like in "python3.11"
+var interpreterVersion = regexp.MustCompile(`[\d.]+$`)
+
+// Guess the language of some text by looking at its first few KB. Returns nil
+// if we can't tell.
+func detectLexer(start []byte) chroma.Lexer {
+	if looksBinary(start) {
+		return nil
+	}
+
+	detectors := []func([]byte) chroma.Lexer{
+		lexerFromShebang,
+		lexerFromModeline,
+		lexerFromFirstLine,
+		lexerFromJSON,
+		func(start []byte) chroma.Lexer {
+			return lexers.Analyse(string(start))
+		},
+	}
+
+	for _, detector := range detectors {
+		lexer := detector(start)
+		if lexer != nil {
+			return lexer
+		}
+	}
+
+	return nil
+}
+
+// Figure out what lexer to use for some text, and remember its name for the
+// status bar
+func (reader *Reader) detectLexer(start []byte) chroma.Lexer {
+	lexer := detectLexer(start)
+	if lexer == nil {
+		return nil
+	}
+
+	name := strings.ToLower(lexer.Config().Name)
+	log.Debug("Language detected from contents: ", name)
+
+	reader.Lock()
+	reader.detectedLanguage = name
+	reader.Unlock()
+
+	return lexer
+}
+
+func getFirstLine(start []byte) string {
+	firstLine, _, _ := bytes.Cut(start, []byte{'\n'})
+	return strings.TrimSpace(string(firstLine))
+}
+
+// "#!/usr/bin/env python3" -> Python
+func lexerFromShebang(start []byte) chroma.Lexer {
+	firstLine := getFirstLine(start)
+	if !strings.HasPrefix(firstLine, "#!") {
+		return nil
+	}
+
+	words := strings.Fields(strings.TrimPrefix(firstLine, "#!"))
+	if len(words) == 0 {
+		return nil
+	}
+
+	interpreter := path.Base(words[0])
+	if interpreter == "env" {
+		// "#!/usr/bin/env -S VAR=value python3 -u"
+		interpreter = ""
+		for _, word := range words[1:] {
+			if strings.HasPrefix(word, "-") || strings.Contains(word, "=") {
+				continue
+			}
+			interpreter = path.Base(word)
+			break
+		}
+	}
+
+	interpreter = interpreterVersion.ReplaceAllString(interpreter, "")
+	if interpreter == "" {
+		return nil
+	}
+
+	if language, found := interpreterLanguages[interpreter]; found {
+		interpreter = language
+	}
+
+	return lexers.Get(interpreter)
+}
+
+// Vim and Emacs modelines in the first lines of the text
+func lexerFromModeline(start []byte) chroma.Lexer {
+	lines := strings.SplitN(string(start), "\n", 6)
+	if len(lines) > 5 {
+		// Vim looks at the first five lines, so do we
+		lines = lines[:5]
+	}
+
+	for _, line := range lines {
+		for _, modeline := range []*regexp.Regexp{vimModeline, emacsModeline, emacsShortModeline} {
+			match := modeline.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+
+			lexer := lexers.Get(match[1])
+			if lexer != nil {
+				return lexer
+			}
+		}
+	}
+
+	return nil
+}
+
+func lexerFromFirstLine(start []byte) chroma.Lexer {
+	firstLine := strings.ToLower(getFirstLine(start))
+	for _, candidate := range firstLinePrefixes {
+		if strings.HasPrefix(firstLine, candidate.prefix) {
+			return lexers.Get(candidate.language)
+		}
+	}
+
+	return nil
+}
+
+// Text starting with a JSON object or array. The text is likely cut off, so we
+// just check that what we have parses.
+func lexerFromJSON(start []byte) chroma.Lexer {
+	trimmed := bytes.TrimSpace(start)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	tokenCount := 0
+	for {
+		_, err := decoder.Token()
+		if err == nil {
+			tokenCount++
+			continue
+		}
+
+		var syntaxError *json.SyntaxError
+		if errors.As(err, &syntaxError) {
+			return nil
+		}
+
+		// End of what we have
+		break
+	}
+
+	// "[1]" is likely JSON, "[INFO]" won't parse
+	if tokenCount < 3 {
+		return nil
+	}
+
+	return lexers.Get("json")
+}
@@ -0,0 +1,87 @@
+package m
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"gotest.tools/v3/assert"
+)
+
+func detectedLanguage(text string) string {
+	lexer := detectLexer([]byte(text))
+	if lexer == nil {
+		return ""
+	}
+	return strings.ToLower(lexer.Config().Name)
+}
+
+func TestDetectLanguageFromShebang(t *testing.T) {
+	assert.Equal(t, detectedLanguage("#!/bin/sh\necho hello\n"), "bash")
+	assert.Equal(t, detectedLanguage("#!/usr/bin/env python3\nprint('hello')\n"), "python")
+	assert.Equal(t, detectedLanguage("#!/usr/bin/env -S PYTHONUNBUFFERED=1 python3.11 -u\n"), "python")
+	assert.Equal(t, detectedLanguage("#!/usr/bin/env node\n"), "javascript")
+	assert.Equal(t, detectedLanguage("#!/usr/bin/env\n"), "")
+}
+
+func TestDetectLanguageFromModeline(t *testing.T) {
+	assert.Equal(t, detectedLanguage("# vim: set ft=yaml:\nkey: value\n"), "yaml")
+	assert.Equal(t, detectedLanguage("# -*- mode: python -*-\nx = 1\n"), "python")
+	assert.Equal(t, detectedLanguage("# -*- ruby -*-\nputs 1\n"), "ruby")
+
+	// Only the first five lines count
+	assert.Equal(t, detectedLanguage("1\n2\n3\n4\n5\n# vim: ft=yaml\n"), "")
+}
+
+func TestDetectLanguageFromFirstLine(t *testing.T) {
+	assert.Equal(t, detectedLanguage("<?xml version=\"1.0\"?>\n<root/>\n"), "xml")
+	assert.Equal(t, detectedLanguage("<!DOCTYPE html>\n<html></html>\n"), "html")
+	assert.Equal(t, detectedLanguage("diff --git a/x b/x\n--- a/x\n+++ b/x\n"), "diff")
+}
+
+func TestDetectJSON(t *testing.T) {
+	assert.Equal(t, detectedLanguage("{\"key\": [1, 2"), "json")
+	assert.Equal(t, detectedLanguage("  [\n  {\"a\": true}\n]\n"), "json")
+
+	// Log lines, not JSON
+	assert.Equal(t, detectedLanguage("[INFO] Starting up\n"), "")
+	assert.Equal(t, detectedLanguage("[x]\n"), "")
+}
+
+func TestDetectLanguageNothing(t *testing.T) {
+	assert.Equal(t, detectedLanguage(""), "")
+	assert.Equal(t, detectedLanguage("Just some text\nwith two lines\n"), "")
+	assert.Equal(t, detectedLanguage("#!/bin/sh\x00\x01\x02\x03"), "")
+}
+
+func TestDetectLanguageOfStream(t *testing.T) {
+	reader := NewReaderFromStream("", strings.NewReader("{\n  \"key\": \"value\"\n}\n"), *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, reader._wait())
+
+	assert.Assert(t, strings.Contains(reader.GetLine(2).raw, "\x1b["), reader.GetLine(2).raw)
+	lines, _ := reader.GetLines(1, 10)
+	assert.Equal(t, lines.statusText, "3 lines  100%  json")
+}
+
+func TestDetectLanguageOfStreamWithoutFormatter(t *testing.T) {
+	reader := NewReaderFromStream("", strings.NewReader("{\n  \"key\": \"value\"\n}\n"), *styles.Get("native"), nil, nil)
+	assert.NilError(t, reader._wait())
+
+	lines, _ := reader.GetLines(1, 10)
+	assert.Equal(t, lines.statusText, "3 lines  100%")
+}
+
+// Files are highlighted based on their names only
+func TestDontDetectLanguageOfFile(t *testing.T) {
+	filename := t.TempDir() + "/script"
+	assert.NilError(t, os.WriteFile(filename, []byte("#!/usr/bin/env python3\nprint('hello')\n"), 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	assert.Equal(t, reader.GetLine(2).raw, "print('hello')")
+	assert.Equal(t, reader.detectedLanguage, "")
+}
@@ -0,0 +1,288 @@
+package m
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/alecthomas/chroma/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/walles/moar/twin"
+)
+
+// Like "ls --color", bold blue
+const directoryNameStyle = "\x1b[1;34m"
+
+// The files in a directory, one per line. Pressing Enter opens the selected
+// one.
+type _DirectoryListing struct {
+	// Entry n is on line n+1, these are their full paths
+	entries []string
+
+	// The entry the user has selected
+	selectedLineOneBased int
+
+	// Opens one of our entries for viewing
+	open func(path string) (*Reader, error)
+}
+
+// Where to go back to from a file opened from a directory listing
+type _ListingPosition struct {
+	reader         LineSource
+	scrollPosition scrollPosition
+}
+
+// List the contents of a directory. Entries are opened using the same settings
+// as the directory.
+func newReaderFromDirectory(dirname string, style chroma.Style, formatter chroma.Formatter, options ReaderOptions) (*Reader, error) {
+	dirEntries, err := os.ReadDir(dirname)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{}
+	entries := []string{}
+
+	cleaned := filepath.Clean(dirname)
+	if parent := filepath.Dir(cleaned); parent != cleaned {
+		lines = append(lines, formatDirectoryEntry("..", nil))
+		entries = append(entries, parent)
+	}
+
+	for _, dirEntry := range dirEntries {
+		path := filepath.Join(dirname, dirEntry.Name())
+		info, err := dirEntry.Info()
+		if err != nil {
+			// Deleted since we listed the directory, never mind
+			log.Debug("Skipping directory entry ", path, ": ", err)
+			continue
+		}
+
+		lines = append(lines, formatDirectoryEntry(path, info))
+		entries = append(entries, path)
+	}
+
+	reader := NewReaderFromText(dirname, strings.Join(lines, "\n"))
+	reader.listing = &_DirectoryListing{
+		entries:              entries,
+		selectedLineOneBased: 1,
+		open: func(path string) (*Reader, error) {
+			return NewReaderFromFilenameWithOptions(path, style, formatter, nil, options)
+		},
+	}
+
+	return reader, nil
+}
+
+// Format a directory entry like "  1.2K  2024-01-31 17:42  README.md". Info is
+// nil for the parent directory entry.
+func formatDirectoryEntry(path string, info os.FileInfo) string {
+	if info == nil {
+		return fmt.Sprintf("%6s  %16s  %s", "", "", directoryNameStyle+"../\x1b[m")
+	}
+
+	size := "-"
+	name := escapeControlChars(filepath.Base(path))
+	switch {
+	case info.IsDir():
+		name = directoryNameStyle + name + "/\x1b[m"
+
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err == nil {
+			name += " -> " + escapeControlChars(target)
+		}
+
+	default:
+		size = formatFileSize(info.Size())
+	}
+
+	return fmt.Sprintf("%6s  %s  %s", size, info.ModTime().Format("2006-01-02 15:04"), name)
+}
+
+// File names can contain anything, including escape sequences that would mess
+// up our listing. Show control characters as '?', just like ls does.
+func escapeControlChars(name string) string {
+	return strings.Map(func(char rune) rune {
+		if unicode.IsControl(char) {
+			return '?'
+		}
+		return char
+	}, name)
+}
+
+// Like "ls -lh", so "999", "1.0K", "12K", "3.4M"
+func formatFileSize(size int64) string {
+	if size < 1000 {
+		return fmt.Sprint(size)
+	}
+
+	value := float64(size)
+	for _, unit := range []string{"K", "M", "G", "T", "P"} {
+		value /= 1024
+		if value < 9.95 {
+			return fmt.Sprintf("%.1f%s", value, unit)
+		}
+		if value < 999.5 || unit == "P" {
+			return fmt.Sprintf("%.0f%s", value, unit)
+		}
+	}
+
+	panic("Unreachable")
+}
+
+// The directory listing we're showing, or nil if we aren't showing one
+func (p *Pager) currentListing() *_DirectoryListing {
+	reader := asReader(p.reader)
+	if reader == nil {
+		return nil
+	}
+
+	return reader.listing
+}
+
+// Open the selected entry of the directory listing we're showing
+func (p *Pager) openSelectedEntry() {
+	listing := p.currentListing()
+	if listing == nil {
+		return
+	}
+	if listing.selectedLineOneBased < 1 || listing.selectedLineOneBased > len(listing.entries) {
+		log.Debug("No directory entry on line ", listing.selectedLineOneBased)
+		return
+	}
+
+	path := listing.entries[listing.selectedLineOneBased-1]
+	reader, err := listing.open(path)
+	if err != nil {
+		log.Info("Opening ", path, " failed: ", err)
+		p.setStatusMessage(err.Error())
+		return
+	}
+
+	reader.Lock()
+	reader.openedFrom = &_ListingPosition{
+		reader:         p.reader,
+		scrollPosition: p.scrollPosition,
+	}
+	reader.Unlock()
+
+	p.own(reader)
+	p.watchReader(reader)
+	p.reader = reader
+	p.scrollPosition = newScrollPosition("Pager scroll position")
+	p.leftColumnZeroBased = 0
+	p.TargetLineNumberOneBased = 0
+}
+
+// If the current file was opened from a directory listing, go back there
+func (p *Pager) backToListing() {
+	if p.isShowingHelp {
+		return
+	}
+
+	reader := asReader(p.reader)
+	if reader == nil {
+		return
+	}
+	if reader.hexDumpOf != nil {
+		reader = reader.hexDumpOf
+	}
+
+	reader.Lock()
+	openedFrom := reader.openedFrom
+	reader.Unlock()
+	if openedFrom == nil {
+		return
+	}
+
+	p.stopReader(reader)
+	delete(p.viewPositions, reader)
+	delete(p.viewPositions, reader.hexDump)
+	delete(p.hexViewChecked, reader)
+
+	p.reader = openedFrom.reader
+	p.scrollPosition = openedFrom.scrollPosition
+	p.leftColumnZeroBased = 0
+	p.TargetLineNumberOneBased = 0
+}
+
+// Keys that work differently in directory listings. Returns true if the key
+// was handled.
+func (p *Pager) onListingKey(keyCode twin.KeyCode) bool {
+	switch keyCode {
+	case twin.KeyUp:
+		p.moveSelection(-1)
+
+	case twin.KeyDown:
+		p.moveSelection(1)
+
+	case twin.KeyEnter:
+		p.openSelectedEntry()
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+// See onListingKey()
+func (p *Pager) onListingRune(char rune) bool {
+	switch char {
+	case 'k', 'y', '\x10':
+		p.moveSelection(-1)
+
+	case 'j', 'e', '\x0e':
+		p.moveSelection(1)
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+// Move the directory listing selection, scrolling to keep it visible
+func (p *Pager) moveSelection(delta int) {
+	listing := p.currentListing()
+	selected := listing.selectedLineOneBased + delta
+	if selected > len(listing.entries) {
+		selected = len(listing.entries)
+	}
+	if selected < 1 {
+		selected = 1
+	}
+	listing.selectedLineOneBased = selected
+
+	firstVisible := p.lineNumberOneBased()
+	lastVisible := firstVisible + p.visibleHeight() - 1
+	if selected < firstVisible {
+		p.scrollPosition = NewScrollPositionFromLineNumberOneBased(selected, "moveSelection")
+	} else if selected > lastVisible {
+		p.scrollPosition = NewScrollPositionFromLineNumberOneBased(selected-p.visibleHeight()+1, "moveSelection")
+	}
+}
+
+// Keep the selection on screen when the user scrolls by other means than
+// moving the selection
+func (listing *_DirectoryListing) clampSelection(firstVisibleLineOneBased int, lastVisibleLineOneBased int) {
+	if listing.selectedLineOneBased < firstVisibleLineOneBased {
+		listing.selectedLineOneBased = firstVisibleLineOneBased
+	}
+	if listing.selectedLineOneBased > lastVisibleLineOneBased {
+		listing.selectedLineOneBased = lastVisibleLineOneBased
+	}
+}
+
+func (listing *_DirectoryListing) highlightSelection(cells []twin.Cell, lineNumberOneBased int) {
+	if lineNumberOneBased != listing.selectedLineOneBased {
+		return
+	}
+
+	for i := range cells {
+		cells[i].Style = cells[i].Style.WithAttr(twin.AttrReverse)
+	}
+}
@@ -0,0 +1,171 @@
+package m
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+// Create a directory with a file and a subdirectory in it
+func createTestDirectory(t *testing.T) string {
+	dirname := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(dirname, "a.txt"), []byte("hello\n"), 0o600))
+	assert.NilError(t, os.Mkdir(filepath.Join(dirname, "sub"), 0o700))
+	assert.NilError(t, os.WriteFile(filepath.Join(dirname, "sub", "b.txt"), []byte("inner\n"), 0o600))
+	return dirname
+}
+
+func openDirectory(t *testing.T, dirname string) *Pager {
+	reader, err := NewReaderFromFilename(dirname, *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, err)
+	assert.Assert(t, reader.listing != nil)
+
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+	return pager
+}
+
+func TestDirectoryListing(t *testing.T) {
+	pager := openDirectory(t, createTestDirectory(t))
+	reader := pager.reader
+
+	assert.Equal(t, reader.GetLineCount(), 3)
+	assert.Assert(t, strings.HasSuffix(reader.GetLine(1).Plain(nil), " ../"), reader.GetLine(1).Plain(nil))
+	assert.Assert(t, strings.HasPrefix(reader.GetLine(2).Plain(nil), "     6  "), reader.GetLine(2).Plain(nil))
+	assert.Assert(t, strings.HasSuffix(reader.GetLine(2).Plain(nil), " a.txt"), reader.GetLine(2).Plain(nil))
+	assert.Assert(t, strings.HasSuffix(reader.GetLine(3).Plain(nil), " sub/"), reader.GetLine(3).Plain(nil))
+
+	// The selected entry should be highlighted
+	pager.redraw("")
+	screen := pager.screen.(*twin.FakeScreen)
+	assert.Equal(t, screen.GetRow(0)[10].Style, twin.StyleDefault.WithAttr(twin.AttrReverse))
+	assert.Equal(t, screen.GetRow(1)[10].Style, twin.StyleDefault)
+}
+
+// File names are under somebody else's control, they shouldn't be able to send
+// escape sequences to our terminal
+func TestDirectoryListingEscapesNames(t *testing.T) {
+	dirname := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(dirname, "evil\x1b[31m.txt"), []byte("hello\n"), 0o600))
+	assert.NilError(t, os.Symlink("target\x1b]0;title\a", filepath.Join(dirname, "link")))
+
+	pager := openDirectory(t, dirname)
+	reader := pager.reader
+	assert.Assert(t, strings.HasSuffix(reader.GetLine(2).Plain(nil), " evil?[31m.txt"), reader.GetLine(2).Plain(nil))
+	assert.Assert(t, strings.HasSuffix(reader.GetLine(3).Plain(nil), " link -> target?]0;title?"), reader.GetLine(3).Plain(nil))
+}
+
+// Selections outside of the listing shouldn't open anything
+func TestOpenSelectedEntryOutOfBounds(t *testing.T) {
+	pager := openDirectory(t, createTestDirectory(t))
+	listing := pager.currentListing()
+
+	for _, selected := range []int{0, len(listing.entries) + 1} {
+		listing.selectedLineOneBased = selected
+		pager.openSelectedEntry()
+		assert.Equal(t, pager.currentListing(), listing)
+	}
+}
+
+func TestOpenFileFromDirectory(t *testing.T) {
+	pager := openDirectory(t, createTestDirectory(t))
+	listing := pager.reader.(*Reader)
+
+	pager.onKey(twin.KeyDown)
+	pager.onKey(twin.KeyEnter)
+	assert.NilError(t, pager.reader.(*Reader)._wait())
+	assert.Equal(t, pager.reader.GetLine(1).Plain(nil), "hello")
+
+	// Back to the listing, with the same entry selected
+	pager.onKey(twin.KeyBackspace)
+	assert.Equal(t, pager.reader, listing)
+	assert.Equal(t, listing.listing.selectedLineOneBased, 2)
+
+	// Backspace in the listing itself should do nothing
+	pager.onKey(twin.KeyBackspace)
+	assert.Equal(t, pager.reader, listing)
+}
+
+func TestLessCloseFromDirectory(t *testing.T) {
+	dirname := createTestDirectory(t)
+	closed := filepath.Join(t.TempDir(), "closed.txt")
+	reader, err := NewReaderFromFilenameWithOptions(dirname, *styles.Get("native"), formatters.TTY16m, nil, ReaderOptions{
+		LessOpen:  "|tr a-z A-Z < %s",
+		LessClose: "echo %s > " + shellQuote(closed),
+	})
+	assert.NilError(t, err)
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+
+	pager.onKey(twin.KeyDown)
+	pager.onKey(twin.KeyEnter)
+	file := pager.reader.(*Reader)
+	assert.NilError(t, file._wait())
+	assert.Equal(t, file.GetLine(1).Plain(nil), "HELLO")
+
+	// Quitting while looking at the file should close it
+	openReaders := pager.openReaders()
+	assert.Equal(t, len(openReaders), 2)
+	assert.Equal(t, openReaders[0], file)
+	assert.Equal(t, openReaders[1], reader)
+	for _, openReader := range openReaders {
+		openReader.runLessClose()
+	}
+	contents, err := os.ReadFile(closed)
+	assert.NilError(t, err)
+	assert.Equal(t, string(contents), filepath.Join(dirname, "a.txt")+"\n")
+}
+
+func TestOpenSubdirectory(t *testing.T) {
+	pager := openDirectory(t, createTestDirectory(t))
+
+	pager.onRune('j')
+	pager.onRune('j')
+	pager.onKey(twin.KeyEnter)
+	assert.Assert(t, pager.currentListing() != nil)
+	assert.Equal(t, pager.reader.GetLineCount(), 2)
+	assert.Assert(t, strings.HasSuffix(pager.reader.GetLine(2).Plain(nil), " b.txt"))
+
+	// Going up using ".." should give us a new listing of the parent
+	pager.onKey(twin.KeyEnter)
+	assert.Assert(t, pager.currentListing() != nil)
+	assert.Equal(t, pager.reader.GetLineCount(), 3)
+}
+
+func TestDirectorySelectionFollowsScrolling(t *testing.T) {
+	dirname := t.TempDir()
+	for i := 0; i < 30; i++ {
+		assert.NilError(t, os.WriteFile(filepath.Join(dirname, fmt.Sprintf("file%02d", i)), []byte{}, 0o600))
+	}
+	pager := openDirectory(t, dirname)
+	pager.redraw("")
+
+	// Moving the selection off screen should scroll
+	for i := 0; i < 12; i++ {
+		pager.onKey(twin.KeyDown)
+	}
+	assert.Equal(t, pager.currentListing().selectedLineOneBased, 13)
+	assert.Equal(t, pager.lineNumberOneBased(), 5)
+
+	// Scrolling by other means should bring the selection along
+	pager.onRune('<')
+	pager.redraw("")
+	assert.Equal(t, pager.currentListing().selectedLineOneBased, 9)
+}
+
+func TestFormatFileSize(t *testing.T) {
+	assert.Equal(t, formatFileSize(0), "0")
+	assert.Equal(t, formatFileSize(999), "999")
+	assert.Equal(t, formatFileSize(1000), "1.0K")
+	assert.Equal(t, formatFileSize(1024), "1.0K")
+	assert.Equal(t, formatFileSize(12*1024), "12K")
+	assert.Equal(t, formatFileSize(1023*1024), "1.0M")
+	assert.Equal(t, formatFileSize(3_500_000), "3.3M")
+}
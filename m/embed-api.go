@@ -1,22 +1,294 @@
 package m
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+
+	"github.com/alecthomas/chroma/v2"
 	"github.com/walles/moar/twin"
 )
 
 // Page displays text in a pager.
 func (p *Pager) Page() error {
-	screen, e := twin.NewScreen()
-	if e != nil {
-		// Screen setup failed
-		return e
+	_, err := p.PageWithOptions(context.Background(), PageOptions{})
+	return err
+}
+
+// PageOptions configures PageWithOptions(). The zero value gives you the same
+// behavior as Page().
+type PageOptions struct {
+	// Where to show the pager. If nil, a terminal screen will be set up using
+	// MouseMode and ColorType, and closed when we're done.
+	//
+	// If you pass your own screen, closing it is up to you.
+	Screen twin.Screen
+
+	// Used when setting up the screen, see twin.MouseMode
+	MouseMode twin.MouseMode
+
+	// Used when setting up the screen. With twin.ColorTypeDefault we guess
+	// based on $TERM.
+	ColorType twin.ColorType
+
+	// Used for coloring the status bar and unstyled text. Set both or
+	// neither.
+	Style     *chroma.Style
+	Formatter *chroma.Formatter
+
+	// Replace the built-in actions of these keys. The functions are called
+	// from the pager's main loop, so they can call p.Quit() for example.
+	KeyBindings map[rune]func(p *Pager)
+
+	// Like KeyBindings, but for keys that don't produce any characters, like
+	// twin.KeyEscape or twin.KeyPgDown.
+	KeyCodeBindings map[twin.KeyCode]func(p *Pager)
+
+	// If set, search for this right away and scroll to the first hit, just
+	// like "less -p".
+	InitialSearch string
+}
+
+// PagerState tells you where the user was when the pager exited
+type PagerState struct {
+	// What was being shown. With multiple files, this is the one the user
+	// was looking at.
+	Source LineSource
+
+	// The lines that were visible on screen
+	FirstVisibleLineOneBased int
+	LastVisibleLineOneBased  int
+
+	// The last search, empty if there was none
+	SearchString string
+}
+
+// Sent to the main loop when the PageWithOptions() context is done
+type eventContextDone struct{}
+
+// PageWithOptions displays text in a pager, until the user quits or the context
+// is done. Returns what the pager looked like at the end.
+//
+// If the context was done, its error will be returned along with the pager
+// state.
+func (p *Pager) PageWithOptions(ctx context.Context, options PageOptions) (PagerState, error) {
+	screen := options.Screen
+	if screen == nil {
+		var err error
+		if options.ColorType == twin.ColorTypeDefault {
+			screen, err = twin.NewScreenWithMouseMode(options.MouseMode)
+		} else {
+			screen, err = twin.NewScreenWithMouseModeAndColorType(options.MouseMode, options.ColorType)
+		}
+		if err != nil {
+			// Screen setup failed
+			return PagerState{}, err
+		}
+	}
+
+	p.keyBindings = options.KeyBindings
+	p.keyCodeBindings = options.KeyCodeBindings
+	if options.InitialSearch != "" {
+		p.searchEditor.setText(options.InitialSearch)
+		p.searchPattern = toPattern(options.InitialSearch)
+		p.initialSearchNextLine = 1
+	}
+
+	// Stop paging when the context is done
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			select {
+			case screen.Events() <- eventContextDone{}:
+			case <-stopped:
+			}
+		case <-stopped:
+		}
+	}()
+
+	p.StartPaging(screen, options.Style, options.Formatter)
+	close(stopped)
+
+	state := p.state()
+	if options.Screen != nil {
+		// Not our screen, not our business
+		return state, ctx.Err()
 	}
 
-	p.StartPaging(screen, nil, nil)
 	screen.Close()
 	if p.DeInit {
-		return nil
+		return state, ctx.Err()
+	}
+
+	err := p.ReprintAfterExit()
+	if err != nil {
+		return state, err
+	}
+	return state, ctx.Err()
+}
+
+// Where is the user right now?
+func (p *Pager) state() PagerState {
+	if p.isShowingHelp {
+		// Get back to what the user was looking at before asking for help
+		p.Quit()
+	}
+
+	state := PagerState{
+		Source:                   p.reader,
+		FirstVisibleLineOneBased: p.lineNumberOneBased(),
+		SearchString:             p.searchEditor.text,
+	}
+
+	lastVisible := p.getLastVisiblePosition()
+	if lastVisible != nil {
+		state.LastVisibleLineOneBased = lastVisible.lineNumberOneBased(p)
 	}
 
-	return p.ReprintAfterExit()
+	return state
+}
+
+// ErrReaderClosed is returned when appending lines to an AppendableReader that
+// has been closed.
+var ErrReaderClosed = errors.New("reader closed")
+
+// AppendableReader is a Reader that you add lines to yourself, see
+// NewAppendableReader().
+type AppendableReader struct {
+	*Reader
+}
+
+// NewAppendableReader creates a Reader that you add lines to yourself, using
+// AppendLines(). Call Close() when you're done adding lines.
+//
+// The name will be displayed by the pager in the bottom left corner. It can be
+// empty ("").
+func NewAppendableReader(name string) *AppendableReader {
+	done := atomic.Bool{}
+	done.Store(false)
+	highlightingDone := atomic.Bool{}
+	highlightingDone.Store(true) // No highlighting to do = nothing left = Done!
+	returnMe := &Reader{
+		moreLinesAdded:   make(chan bool, 1),
+		maybeDone:        make(chan bool, 1),
+		highlightingDone: &highlightingDone,
+		done:             &done,
+	}
+	if name != "" {
+		returnMe.name = &name
+	}
+
+	return &AppendableReader{returnMe}
+}
+
+// AppendLines adds lines to the Reader. Any newlines inside of the strings
+// will split them into multiple lines.
+//
+// This method is safe to call from any goroutine, while the pager is running.
+func (reader *AppendableReader) AppendLines(lines ...string) error {
+	reader.Lock()
+	if reader.done.Load() {
+		reader.Unlock()
+		return ErrReaderClosed
+	}
+
+	for _, text := range lines {
+		for _, lineString := range strings.Split(text, "\n") {
+			line := NewLine(lineString)
+			reader.lines = append(reader.lines, &line)
+		}
+	}
+	reader.Unlock()
+
+	select {
+	case reader.moreLinesAdded <- true:
+	default:
+	}
+
+	return nil
+}
+
+// Close marks the Reader as done. No more lines can be added after this.
+func (reader *AppendableReader) Close() error {
+	return reader.CloseWithError(nil)
+}
+
+// CloseWithError works like Close(), but also reports a problem to the user.
+// The error will be shown in the pager's status bar, and returned by Err()
+// and Wait().
+func (reader *AppendableReader) CloseWithError(err error) error {
+	reader.Lock()
+	if reader.done.Load() {
+		reader.Unlock()
+		return ErrReaderClosed
+	}
+	reader.err = err
+	reader.done.Store(true)
+	reader.Unlock()
+
+	reader.reportMaybeDone()
+
+	return nil
+}
+
+// Done returns true if the Reader is done reading and highlighting its input.
+func (reader *Reader) Done() bool {
+	return reader.done.Load() && reader.highlightingDone.Load()
+}
+
+// Wait blocks until the Reader is Done(), then returns the same thing as
+// Err().
+//
+// Readers following their input never finish, don't Wait() for those.
+func (reader *Reader) Wait() error {
+	<-reader.doneChannel()
+	return reader.Err()
+}
+
+// Gets closed when we're Done()
+func (reader *Reader) doneChannel() <-chan struct{} {
+	reader.Lock()
+	defer reader.Unlock()
+
+	if reader.doneChan == nil {
+		reader.doneChan = make(chan struct{})
+	}
+
+	select {
+	case <-reader.doneChan:
+		// Already closed
+	default:
+		if reader.Done() {
+			close(reader.doneChan)
+		}
+	}
+
+	return reader.doneChan
+}
+
+// Call this after setting done or highlightingDone. Tells the pager and
+// Wait() that we may be Done() now.
+func (reader *Reader) reportMaybeDone() {
+	select {
+	case reader.maybeDone <- true:
+	default:
+	}
+
+	_ = reader.doneChannel()
+}
+
+// Err returns whatever went wrong reading the input, if anything. Until the
+// Reader is Done(), more problems may come up.
+func (reader *Reader) Err() error {
+	reader.Lock()
+	defer reader.Unlock()
+	return reader.err
+}
+
+// Styled returns the line's contents including any ANSI styling, like
+// highlighting or colors from the input. Line endings are not included.
+func (line *Line) Styled() string {
+	return line.raw
 }
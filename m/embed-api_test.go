@@ -0,0 +1,203 @@
+package m
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func TestAppendableReader(t *testing.T) {
+	reader := NewAppendableReader("producer")
+	assert.Assert(t, !reader.Done())
+
+	go func() {
+		for i := 1; i <= 100; i++ {
+			assert.NilError(t, reader.AppendLines(fmt.Sprintf("Line %d", i)))
+		}
+		assert.NilError(t, reader.Close())
+	}()
+
+	assert.NilError(t, reader.Wait())
+	assert.Assert(t, reader.Done())
+	assert.Equal(t, reader.GetLineCount(), 100)
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "Line 1")
+	assert.Equal(t, reader.GetLine(100).Plain(nil), "Line 100")
+
+	lines, _ := reader.GetLines(1, 10)
+	assert.Equal(t, lines.statusText, "producer: 100 lines  10%")
+
+	assert.Equal(t, reader.AppendLines("too late"), ErrReaderClosed)
+	assert.Equal(t, reader.Close(), ErrReaderClosed)
+	assert.Equal(t, reader.GetLineCount(), 100)
+}
+
+func TestAppendableReaderSplitsLines(t *testing.T) {
+	reader := NewAppendableReader("")
+	assert.NilError(t, reader.AppendLines("one\ntwo", "\x1b[1mthree\x1b[m"))
+	assert.NilError(t, reader.Close())
+
+	assert.Equal(t, reader.GetLineCount(), 3)
+	assert.Equal(t, reader.GetLine(2).Plain(nil), "two")
+	assert.Equal(t, reader.GetLine(3).Plain(nil), "three")
+	assert.Equal(t, reader.GetLine(3).Styled(), "\x1b[1mthree\x1b[m")
+}
+
+func TestAppendableReaderError(t *testing.T) {
+	reader := NewAppendableReader("failing")
+	assert.NilError(t, reader.AppendLines("partial output"))
+
+	problem := errors.New("producer failed")
+	assert.NilError(t, reader.CloseWithError(problem))
+	assert.Equal(t, reader.Wait(), problem)
+	assert.Equal(t, reader.Err(), problem)
+	assert.Equal(t, reader.problemSummary(), "producer failed")
+}
+
+// Several goroutines should be able to Wait() at the same time
+func TestWaitFromManyGoroutines(t *testing.T) {
+	reader := NewAppendableReader("")
+
+	waiters := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		waiters.Add(1)
+		go func() {
+			defer waiters.Done()
+			assert.NilError(t, reader.Wait())
+		}()
+	}
+
+	assert.NilError(t, reader.AppendLines("hello"))
+	assert.NilError(t, reader.Close())
+	waiters.Wait()
+
+	// Waiting for a Reader that is already done shouldn't block
+	assert.NilError(t, NewReaderFromText("text", "hello").Wait())
+}
+
+func TestWaitForHighlighting(t *testing.T) {
+	reader := NewReaderFromStream("", strings.NewReader("package main\n"), *styles.Get("native"), formatters.TTY16m, lexers.Get("go"))
+	assert.NilError(t, reader.Wait())
+
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "package main")
+	assert.Assert(t, strings.Contains(reader.GetLine(1).Styled(), "\x1b["), reader.GetLine(1).Styled())
+}
+
+// A FakeScreen that can deliver events
+type eventfulScreen struct {
+	*twin.FakeScreen
+	events chan twin.Event
+}
+
+func (screen eventfulScreen) Events() chan twin.Event {
+	return screen.events
+}
+
+func TestPageWithOptionsCancel(t *testing.T) {
+	reader := NewAppendableReader("numbers")
+	for i := 1; i <= 100; i++ {
+		assert.NilError(t, reader.AppendLines(fmt.Sprintf("Line %d", i)))
+	}
+	assert.NilError(t, reader.Close())
+
+	screen := eventfulScreen{
+		FakeScreen: twin.NewFakeScreen(80, 10),
+		events:     make(chan twin.Event, 10),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	state, err := NewPager(reader).PageWithOptions(ctx, PageOptions{
+		Screen:        screen,
+		InitialSearch: "Line 50",
+	})
+	assert.Equal(t, err, context.Canceled)
+	assert.Equal(t, state.Source, LineSource(reader))
+	assert.Equal(t, state.FirstVisibleLineOneBased, 50)
+	assert.Equal(t, state.LastVisibleLineOneBased, 58)
+	assert.Equal(t, state.SearchString, "Line 50")
+}
+
+func TestInitialSearchWhileReading(t *testing.T) {
+	reader := NewAppendableReader("")
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+	pager.searchPattern = toPattern("needle")
+	pager.initialSearchNextLine = 1
+
+	assert.NilError(t, reader.AppendLines("hay", "hay"))
+	pager.maybeScrollToInitialSearchHit()
+	assert.Equal(t, pager.initialSearchNextLine, 3)
+
+	assert.NilError(t, reader.AppendLines(strings.Repeat("hay\n", 20)+"needle"))
+	pager.maybeScrollToInitialSearchHit()
+	assert.Equal(t, pager.initialSearchNextLine, 0)
+	assert.Equal(t, pager.lineNumberOneBased(), 15) // Scrolled as far down as we can
+}
+
+func TestKeyBindings(t *testing.T) {
+	pager := NewPager(NewReaderFromText("text", "hello"))
+	pager.screen = twin.NewFakeScreen(80, 10)
+
+	pressed := false
+	pager.keyBindings = map[rune]func(p *Pager){
+		'q': func(p *Pager) {
+			pressed = true
+		},
+	}
+
+	pager.onRune('q')
+	assert.Assert(t, pressed)
+	assert.Assert(t, !pager.quit)
+}
+
+func TestKeyCodeBindings(t *testing.T) {
+	pager := NewPager(NewReaderFromText("text", "hello"))
+	pager.screen = twin.NewFakeScreen(80, 10)
+
+	pressed := false
+	pager.keyCodeBindings = map[twin.KeyCode]func(p *Pager){
+		twin.KeyEscape: func(p *Pager) {
+			pressed = true
+		},
+	}
+
+	pager.onKey(twin.KeyEscape)
+	assert.Assert(t, pressed)
+	assert.Assert(t, !pager.quit)
+}
+
+// Searching through lots of lines shouldn't block the main loop
+func TestInitialSearchInLargeInput(t *testing.T) {
+	reader := NewAppendableReader("")
+	assert.NilError(t, reader.AppendLines(strings.Repeat("hay\n", initialSearchLinesPerPass*2)+"needle"))
+	assert.NilError(t, reader.Close())
+
+	pager := NewPager(reader)
+	pager.screen = eventfulScreen{
+		FakeScreen: twin.NewFakeScreen(80, 10),
+		events:     make(chan twin.Event, 10),
+	}
+	pager.searchPattern = toPattern("needle")
+	pager.initialSearchNextLine = 1
+
+	pager.maybeScrollToInitialSearchHit()
+	assert.Equal(t, pager.initialSearchNextLine, initialSearchLinesPerPass+1)
+
+	// The main loop should be told to come back here
+	assert.Equal(t, len(pager.screen.Events()), 1)
+
+	pager.maybeScrollToInitialSearchHit()
+	pager.maybeScrollToInitialSearchHit()
+	assert.Equal(t, pager.initialSearchNextLine, 0)
+	assert.Equal(t, pager.lineNumberOneBased(), initialSearchLinesPerPass*2-7) // Scrolled as far down as we can
+}
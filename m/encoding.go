@@ -0,0 +1,245 @@
+package m
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// How much of a file we look at when guessing its encoding
+const encodingSniffSize = 4096
+
+// Guess the encoding of some text by looking at its first bytes.
+//
+// Set atEOF if start is all there is. Otherwise, we will assume there's more
+// text after start, and that the last character of start may be cut off.
+//
+// Returns nil for UTF-8, which is also what we guess when we can't tell.
+func detectEncoding(start []byte, atEOF bool) encoding.Encoding {
+	if bytes.HasPrefix(start, []byte{0xef, 0xbb, 0xbf}) {
+		return unicode.UTF8BOM
+	}
+	if bytes.HasPrefix(start, []byte{0xff, 0xfe}) {
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	}
+	if bytes.HasPrefix(start, []byte{0xfe, 0xff}) {
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	}
+
+	if utf16 := detectUtf16WithoutBom(start); utf16 != nil {
+		return utf16
+	}
+
+	if looksLikeLatin1(start, atEOF) {
+		// Same as Latin-1 for all printable characters, plus some more. This
+		// is what browsers do for Latin-1 as well.
+		return charmap.Windows1252
+	}
+
+	return nil
+}
+
+var boms = [][]byte{
+	{0xef, 0xbb, 0xbf},
+	{0xff, 0xfe},
+	{0xfe, 0xff},
+}
+
+// Returns everything buffered, but if that is the start of a BOM, waits until
+// we have the whole BOM.
+func peekPastBomPrefix(buffered *bufio.Reader) ([]byte, error) {
+	start, err := buffered.Peek(buffered.Buffered())
+	for err == nil {
+		incomplete := false
+		for _, bom := range boms {
+			if len(start) < len(bom) && bytes.HasPrefix(bom, start) {
+				incomplete = true
+			}
+		}
+		if !incomplete {
+			break
+		}
+
+		start, err = buffered.Peek(len(start) + 1)
+	}
+
+	return start, err
+}
+
+// Mostly-ASCII UTF-16 text has lots of zero bytes, all of them either at odd
+// (little endian) or at even (big endian) offsets.
+func detectUtf16WithoutBom(start []byte) encoding.Encoding {
+	pairCount := len(start) / 2
+	if pairCount < 2 {
+		return nil
+	}
+
+	evenZeros := 0
+	oddZeros := 0
+	for i := 0; i < pairCount*2; i += 2 {
+		if start[i] == 0 {
+			evenZeros++
+		}
+		if start[i+1] == 0 {
+			oddZeros++
+		}
+	}
+
+	if oddZeros > pairCount/2 && evenZeros == 0 {
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	}
+	if evenZeros > pairCount/2 && oddZeros == 0 {
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	}
+
+	return nil
+}
+
+// Invalid UTF-8 without any valid multi byte UTF-8 sequences is most likely
+// Latin-1.
+//
+// If we have both valid and invalid sequences, the input is most likely just
+// broken UTF-8.
+func looksLikeLatin1(start []byte, atEOF bool) bool {
+	if !atEOF {
+		// Don't count a character that has been cut off as invalid
+		for i := 1; i < utf8.UTFMax && i <= len(start); i++ {
+			tail := start[len(start)-i:]
+			if utf8.RuneStart(tail[0]) {
+				if !utf8.FullRune(tail) {
+					start = start[:len(start)-i]
+				}
+				break
+			}
+		}
+	}
+
+	hasInvalid := false
+	for len(start) > 0 {
+		char, size := utf8.DecodeRune(start)
+		if char == utf8.RuneError && size == 1 {
+			hasInvalid = true
+		} else if size > 1 {
+			// Valid UTF-8 multi byte sequence
+			return false
+		}
+		start = start[size:]
+	}
+
+	return hasInvalid
+}
+
+// For the status bar. Empty for UTF-8 encodings since that is what we expect.
+func encodingName(enc encoding.Encoding) string {
+	if enc == nil || enc == unicode.UTF8 || enc == unicode.UTF8BOM {
+		return ""
+	}
+
+	name, err := htmlindex.Name(enc)
+	if err == nil {
+		return name
+	}
+
+	// Not all encodings have names in the index, like the BOM-expecting
+	// UTF-16 ones. But they all implement fmt.Stringer: "UTF-16LE (Expect
+	// BOM)". Make that look like the names in the index.
+	name, _, _ = strings.Cut(fmt.Sprint(enc), " (")
+	return strings.ToLower(name)
+}
+
+// Should this file be decoded into UTF-8 before we show it?
+//
+// This is for deciding whether we can highlight the raw file contents, see
+// startHighlightingFromFile().
+func fileNeedsDecoding(file io.ReaderAt, forced encoding.Encoding) bool {
+	enc := forced
+	if enc == nil {
+		start := make([]byte, encodingSniffSize)
+		byteCount, err := file.ReadAt(start, 0)
+		enc = detectEncoding(start[:byteCount], err == io.EOF)
+
+		if enc == charmap.Windows1252 && looksBinary(start[:byteCount]) {
+			// Just like in startDecoding()
+			enc = nil
+		}
+	}
+
+	return enc != nil && enc != unicode.UTF8
+}
+
+// Wrap a stream so that reading from it gives us UTF-8.
+//
+// The encoding is figured out on the first Read(), so that creating one of
+// these never blocks. If the encoding is something we should show in the status
+// bar, it will be stored in the Reader.
+func (reader *Reader) newDecodingStream(stream io.Reader) io.Reader {
+	return &decodingStream{reader: reader, source: stream}
+}
+
+type decodingStream struct {
+	reader  *Reader
+	source  io.Reader
+	decoded io.Reader
+}
+
+func (d *decodingStream) Read(p []byte) (int, error) {
+	if d.decoded == nil {
+		d.decoded = d.reader.startDecoding(d.source)
+	}
+
+	return d.decoded.Read(p)
+}
+
+func (reader *Reader) startDecoding(source io.Reader) io.Reader {
+	buffered := bufio.NewReaderSize(source, encodingSniffSize)
+
+	enc := reader.forcedEncoding
+	if enc == nil {
+		// Look at whatever we got in the first read. Waiting for more could
+		// mean waiting for a slow producer, with nothing on screen.
+		start, err := buffered.Peek(1)
+		if err == nil {
+			start, err = peekPastBomPrefix(buffered)
+		}
+		enc = detectEncoding(start, err != nil)
+
+		if (enc == nil || enc == charmap.Windows1252) && looksBinary(start) {
+			log.Debug("Input looks binary")
+			reader.binary.Store(true)
+
+			// No point in decoding binary data
+			enc = nil
+		}
+	}
+
+	if !reader.binary.Load() {
+		reader.dropRawBytes()
+	}
+
+	if enc == nil || enc == unicode.UTF8 {
+		// Invalid UTF-8 will be shown as such, rather than be replaced by
+		// a decoder
+		return buffered
+	}
+
+	name := encodingName(enc)
+	if name != "" {
+		log.Debug("Decoding input from ", name)
+	}
+
+	reader.Lock()
+	reader.encodingName = name
+	reader.Unlock()
+
+	return transform.NewReader(buffered, enc.NewDecoder())
+}
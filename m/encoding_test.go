@@ -0,0 +1,112 @@
+package m
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"gotest.tools/v3/assert"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	assert.Equal(t, detectEncoding([]byte("hello"), true), nil)
+	assert.Equal(t, detectEncoding([]byte("r\xc3\xa4ksm\xc3\xb6rg\xc3\xa5s"), true), nil)
+	assert.Equal(t, detectEncoding([]byte{}, true), nil)
+
+	assert.Equal(t, detectEncoding([]byte("\xef\xbb\xbfhello"), true), unicode.UTF8BOM)
+	assert.Equal(t, encodingName(detectEncoding([]byte("\xff\xfeh\x00"), true)), "utf-16le")
+	assert.Equal(t, encodingName(detectEncoding([]byte("\xfe\xff\x00h"), true)), "utf-16be")
+	assert.Equal(t, encodingName(detectEncoding([]byte("h\x00e\x00j\x00"), true)), "utf-16le")
+	assert.Equal(t, encodingName(detectEncoding([]byte("\x00h\x00e\x00j"), true)), "utf-16be")
+
+	assert.Equal(t, detectEncoding([]byte("caf\xe9"), true), charmap.Windows1252)
+
+	// Broken UTF-8, not Latin-1
+	assert.Equal(t, detectEncoding([]byte("caf\xc3\xa9 caf\xe9"), true), nil)
+
+	// Possibly a cut off UTF-8 character, can't tell
+	assert.Equal(t, detectEncoding([]byte("caf\xc3"), false), nil)
+}
+
+func readWithEncoding(t *testing.T, input string, options ReaderOptions) *Reader {
+	reader := NewReaderFromStreamWithOptions("", strings.NewReader(input), *styles.Get("native"), formatters.TTY16m, nil, options)
+	assert.NilError(t, reader._wait())
+	return reader
+}
+
+func TestUtf16Stream(t *testing.T) {
+	reader := readWithEncoding(t, "\xff\xfeh\x00\xe5\x00\n\x00j\x00\n\x00", ReaderOptions{})
+
+	assert.Equal(t, reader.GetLineCount(), 2)
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "hå")
+	assert.Equal(t, reader.GetLine(2).Plain(nil), "j")
+
+	reader.Lock()
+	status := reader.createStatusUnlocked(2)
+	reader.Unlock()
+	assert.Equal(t, status, "2 lines  100%  utf-16le")
+}
+
+// A slow producer shouldn't keep us from showing what we have
+func TestShortFirstRead(t *testing.T) {
+	pipeReader, pipeWriter := io.Pipe()
+	defer func() { _ = pipeWriter.Close() }()
+	reader := NewReaderFromStream("", pipeReader, *styles.Get("native"), formatters.TTY16m, nil)
+
+	_, err := pipeWriter.Write([]byte("a\n"))
+	assert.NilError(t, err)
+	deadline := time.Now().Add(5 * time.Second)
+	for reader.GetLineCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "a")
+}
+
+// A BOM arriving in pieces should still be recognized
+func TestSplitBom(t *testing.T) {
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		for _, chunk := range []string{"\xff", "\xfeh\x00\n\x00"} {
+			_, _ = pipeWriter.Write([]byte(chunk))
+		}
+		_ = pipeWriter.Close()
+	}()
+
+	reader := NewReaderFromStream("", pipeReader, *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, reader._wait())
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "h")
+}
+
+func TestLatin1Stream(t *testing.T) {
+	reader := readWithEncoding(t, "caf\xe9\n", ReaderOptions{})
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "café")
+}
+
+func TestForcedEncoding(t *testing.T) {
+	// Would have been detected as UTF-8
+	reader := readWithEncoding(t, "\xc3\xa9\n", ReaderOptions{Encoding: charmap.ISO8859_1})
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "Ã©")
+
+	// Would have been detected as Latin-1
+	reader = readWithEncoding(t, "caf\xe9\n", ReaderOptions{Encoding: unicode.UTF8})
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "caf?")
+}
+
+func TestUtf16File(t *testing.T) {
+	filename := t.TempDir() + "/utf16.txt"
+	err := os.WriteFile(filename, []byte("\xff\xfeh\x00e\x00j\x00\r\x00\n\x00"), 0o600)
+	assert.NilError(t, err)
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	assert.Equal(t, reader.GetLineCount(), 1)
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "hej")
+}
@@ -0,0 +1,175 @@
+package m
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// What a filter prints on stderr, collected as it arrives so that the user
+// can see it while the filter is still running.
+type _FilterStderr struct {
+	sync.Mutex
+	text []byte
+
+	// Called with all text so far, whenever more arrives
+	listener func(stderrText string)
+
+	// Closed when there will be no more text
+	done chan struct{}
+}
+
+// Start collecting stderr in the background. Stderr can be nil, in which case
+// there will be nothing to collect.
+func collectFilterStderr(stderr io.Reader) *_FilterStderr {
+	collector := &_FilterStderr{done: make(chan struct{})}
+	if stderr == nil {
+		close(collector.done)
+		return collector
+	}
+
+	go func() {
+		defer close(collector.done)
+
+		buffer := make([]byte, 4096)
+		for {
+			count, err := stderr.Read(buffer)
+			if count > 0 {
+				collector.Lock()
+				collector.text = append(collector.text, buffer[:count]...)
+				stderrText := strings.TrimSpace(string(collector.text))
+				listener := collector.listener
+				collector.Unlock()
+
+				if listener != nil {
+					listener(stderrText)
+				}
+			}
+
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				log.Warn("Draining filter stderr failed: ", err)
+				return
+			}
+		}
+	}()
+
+	return collector
+}
+
+// Call listener with the text so far, and then whenever more text arrives
+func (collector *_FilterStderr) onUpdate(listener func(stderrText string)) {
+	collector.Lock()
+	collector.listener = listener
+	stderrText := strings.TrimSpace(string(collector.text))
+	collector.Unlock()
+
+	if stderrText != "" {
+		listener(stderrText)
+	}
+}
+
+// Wait until the filter has closed its stderr, and return all text
+func (collector *_FilterStderr) wait() string {
+	<-collector.done
+
+	collector.Lock()
+	defer collector.Unlock()
+	return strings.TrimSpace(string(collector.text))
+}
+
+// One line summary of any problems reading the input, for the status bar.
+// Empty if there were no problems.
+func (reader *Reader) problemSummary() string {
+	reader.Lock()
+	defer reader.Unlock()
+
+	if reader.err != nil {
+		var exitError *exec.ExitError
+		if errors.As(reader.err, &exitError) {
+			summary := "Filter failed with " + exitError.ProcessState.String()
+			if reader.filterStderr != "" {
+				summary += ": " + firstLine(reader.filterStderr)
+			}
+			return summary
+		}
+
+		// Our own error messages all start with "error ..."
+		return firstLine(reader.err.Error())
+	}
+
+	if reader.filterStderr != "" {
+		return "Filter said: " + firstLine(reader.filterStderr)
+	}
+
+	return ""
+}
+
+// Full description of any problems reading the input, or "" if there were no
+// problems.
+func (reader *Reader) problemDetails() string {
+	reader.Lock()
+	defer reader.Unlock()
+
+	details := strings.Builder{}
+	if reader.err != nil {
+		details.WriteString(fmt.Sprintf("Reading the input failed:\n\n%s\n", reader.err.Error()))
+	}
+
+	if reader.filterStderr != "" {
+		if details.Len() > 0 {
+			details.WriteString("\n")
+		}
+		details.WriteString(fmt.Sprintf("Filter error output:\n\n%s\n", reader.filterStderr))
+	}
+
+	return details.String()
+}
+
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	return line
+}
+
+// Problems reading what we're showing, or "" if there are none
+func (p *Pager) problemSummary() string {
+	reader := asReader(p.reader)
+	if reader == nil {
+		return ""
+	}
+
+	return reader.problemSummary()
+}
+
+// Show the full text of any problems reading the current file, the same way
+// we show help
+func (p *Pager) showProblems() {
+	if p.isShowingHelp {
+		return
+	}
+
+	reader := asReader(p.reader)
+	details := ""
+	if reader != nil {
+		details = reader.problemDetails()
+	}
+	if details == "" {
+		p.setStatusMessage("No problems reading this input")
+		return
+	}
+
+	name := "Problems"
+	reader.Lock()
+	if reader.name != nil {
+		name = "Problems reading " + *reader.name
+	}
+	reader.Unlock()
+	p.showHelpReader(NewReaderFromText(name, details))
+}
@@ -0,0 +1,80 @@
+package m
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func TestProblemsFromFailingFilter(t *testing.T) {
+	reader, err := newReaderFromCommand("/ignored", "sh", "-c", "echo hej; echo oops >&2; echo more >&2; exit 3", "sh")
+	assert.NilError(t, err)
+	assert.Assert(t, reader._wait() != nil)
+
+	assert.Equal(t, reader.problemSummary(), "Filter failed with exit status 3: oops")
+	assert.Assert(t, strings.Contains(reader.problemDetails(), "oops\nmore"), reader.problemDetails())
+	assert.Assert(t, strings.Contains(reader.problemDetails(), "exit status 3"), reader.problemDetails())
+}
+
+func TestProblemsFromChattyFilter(t *testing.T) {
+	reader, err := newReaderFromCommand("/ignored", "sh", "-c", "echo hej; echo careful >&2", "sh")
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	assert.Equal(t, reader.problemSummary(), "Filter said: careful")
+	assert.Equal(t, reader.problemDetails(), "Filter error output:\n\ncareful\n")
+}
+
+// Filter stderr should show up while the filter is still running
+func TestProblemsFromRunningFilter(t *testing.T) {
+	reader, err := newReaderFromCommand("/ignored", "sh", "-c", "echo careful >&2; sleep 10", "sh")
+	assert.NilError(t, err)
+	defer reader.stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for reader.problemSummary() == "" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, reader.problemSummary(), "Filter said: careful")
+	assert.Assert(t, !reader.done.Load())
+}
+
+func TestNoProblems(t *testing.T) {
+	reader := NewReaderFromText("text", "hello")
+	assert.Equal(t, reader.problemSummary(), "")
+	assert.Equal(t, reader.problemDetails(), "")
+}
+
+func TestShowProblems(t *testing.T) {
+	compressed := bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(&compressed)
+	_, err := gzipWriter.Write([]byte(strings.Repeat("hello\n", 1000)))
+	assert.NilError(t, err)
+	assert.NilError(t, gzipWriter.Close())
+
+	// Cut the stream off half way through
+	truncated := compressed.Bytes()[:compressed.Len()/2]
+	reader := NewReaderFromStream("truncated", bytes.NewReader(truncated), *styles.Get("native"), formatters.TTY16m, nil)
+	assert.Assert(t, reader._wait() != nil)
+	assert.Equal(t, reader.problemSummary(), "error reading line from input stream: unexpected EOF")
+
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(120, 10)
+	pager.redraw("")
+	assert.Assert(t, strings.Contains(rowToString(pager.screen.(*twin.FakeScreen).GetRow(9)), "unexpected EOF, press 'E' for details"))
+
+	pager.onRune('E')
+	assert.Assert(t, pager.isShowingHelp)
+	assert.Equal(t, pager.reader.GetLine(1).Plain(nil), "Reading the input failed:")
+
+	// Getting out of the problems view should take us back to our input
+	pager.onRune('q')
+	assert.Equal(t, pager.reader, reader)
+}
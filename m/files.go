@@ -0,0 +1,153 @@
+package m
+
+import (
+	"fmt"
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/walles/moar/twin"
+)
+
+// Everything we need to remember about a file while the user is looking at
+// some other file.
+type _FileState struct {
+	// Nil until the file has been opened, see openFile()
+	reader LineSource
+
+	// Opens the file the first time the user switches to it
+	open func() (*Reader, error)
+
+	scrollPosition           scrollPosition
+	leftColumnZeroBased      int
+	targetLineNumberOneBased int
+	searchString             string
+	searchPattern            *regexp.Regexp
+	searchBackwards          bool
+}
+
+func newFileState(source LineSource) _FileState {
+	name := "Pager"
+	if reader := asReader(source); reader != nil && reader.name != nil && len(*reader.name) > 0 {
+		name = "Pager " + *reader.name
+	}
+
+	return _FileState{
+		reader:         source,
+		scrollPosition: newScrollPosition(name),
+	}
+}
+
+// Stash the state of the current file so that we can get back to it later
+func (p *Pager) saveFileState() {
+	p.files[p.currentFileIndex] = _FileState{
+		reader:                   p.reader,
+		scrollPosition:           p.scrollPosition,
+		leftColumnZeroBased:      p.leftColumnZeroBased,
+		targetLineNumberOneBased: p.TargetLineNumberOneBased,
+		searchString:             p.searchEditor.text,
+		searchPattern:            p.searchPattern,
+		searchBackwards:          p.searchBackwards,
+	}
+}
+
+func (p *Pager) loadFileState(fileIndex int) {
+	state := p.files[fileIndex]
+	p.currentFileIndex = fileIndex
+	p.reader = state.reader
+	p.scrollPosition = state.scrollPosition
+	p.leftColumnZeroBased = state.leftColumnZeroBased
+	p.TargetLineNumberOneBased = state.targetLineNumberOneBased
+	p.searchEditor.setText(state.searchString)
+	p.searchPattern = state.searchPattern
+	p.searchBackwards = state.searchBackwards
+}
+
+// Switch to some other file, counting from the current one. Negative deltas
+// move towards the first file.
+func (p *Pager) switchFile(delta int) {
+	if p.isShowingHelp {
+		// The help screen replaces the current file, switching files from there
+		// would make getting back out of help confusing.
+		return
+	}
+
+	newIndex := p.currentFileIndex + delta
+	if newIndex < 0 || newIndex >= len(p.files) {
+		log.Debugf("No file at index %d, staying on file %d/%d", newIndex, p.currentFileIndex+1, len(p.files))
+		return
+	}
+
+	if p.files[newIndex].reader == nil && !p.openFile(newIndex) {
+		return
+	}
+
+	p.saveFileState()
+	p.loadFileState(newIndex)
+}
+
+// Files are opened when the user first switches to them, so that we don't
+// read lots of files up front. Returns false if opening failed.
+func (p *Pager) openFile(fileIndex int) bool {
+	reader, err := p.files[fileIndex].open()
+	if err != nil {
+		log.Info("Opening file ", fileIndex+1, " failed: ", err)
+		p.setStatusMessage(err.Error())
+		return false
+	}
+
+	p.files[fileIndex].reader = reader
+	p.files[fileIndex].open = nil
+	p.own(reader)
+	p.watchReader(reader)
+	return true
+}
+
+// "file 2/5", or "" if we have only one file
+func (p *Pager) fileIndicator() string {
+	if len(p.files) < 2 || p.isShowingHelp {
+		return ""
+	}
+
+	return fmt.Sprintf("file %d/%d", p.currentFileIndex+1, len(p.files))
+}
+
+func (p *Pager) addColonFooter() {
+	_, height := p.screen.Size()
+
+	pos := 0
+	for _, token := range ":" {
+		p.screen.SetCell(pos, height-1, twin.NewCell(token, twin.StyleDefault))
+		pos++
+	}
+
+	// Add a cursor
+	p.screen.SetCell(pos, height-1, twin.NewCell(' ', twin.StyleDefault.WithAttr(twin.AttrReverse)))
+}
+
+func (p *Pager) onColonKey(key twin.KeyCode) {
+	switch key {
+	case twin.KeyEscape, twin.KeyEnter:
+		p.mode = _Viewing
+
+	default:
+		log.Tracef("Unhandled colon key event %v, treating as a viewing key event", key)
+		p.mode = _Viewing
+		p.onKey(key)
+	}
+}
+
+// Handle the second character of less style ":n" / ":p" commands
+func (p *Pager) onColonRune(char rune) {
+	p.mode = _Viewing
+
+	switch char {
+	case 'n':
+		p.switchFile(1)
+
+	case 'p':
+		p.switchFile(-1)
+
+	default:
+		log.Debugf("Unhandled colon command rune '%s'/0x%08x", string(char), int32(char))
+	}
+}
@@ -0,0 +1,104 @@
+package m
+
+import (
+	"io"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Followed files are never Done(). This returns true if we have read and
+// highlighted everything there is for now, so that the pager can stop showing
+// its spinner.
+func (reader *Reader) isCaughtUp() bool {
+	if !reader.readingCaughtUp.Load() {
+		return false
+	}
+
+	return reader.highlightingDone.Load() || reader.highlightingCaughtUp.Load()
+}
+
+// Check whether a file we're following has been truncated, or replaced by a
+// new file with the same name. The latter is what happens on log rotation.
+//
+// Returns the file to keep reading from, and true if we should start reading
+// that file from the start. The returned file will be the same as the one
+// passed in unless the file has been rotated.
+func (reader *Reader) checkForRotation(file *os.File, filename string) (*os.File, bool) {
+	onDisk, err := os.Stat(filename)
+	if err != nil {
+		// Rotated away but not yet replaced, or some other problem. Keep
+		// waiting, and try again next time.
+		log.Trace("Stat failed on followed file: ", err)
+		return file, false
+	}
+
+	current, err := file.Stat()
+	if err != nil {
+		log.Debug("Stat failed on the file we're following: ", err)
+		return file, false
+	}
+
+	if !os.SameFile(onDisk, current) {
+		newFile, err := os.Open(filename)
+		if err != nil {
+			log.Debug("Failed to reopen rotated file: ", err)
+			return file, false
+		}
+
+		err = file.Close()
+		if err != nil {
+			log.Debug("Failed to close rotated file: ", err)
+		}
+
+		log.Debug("Followed file rotated, reopened ", filename)
+		reader.noteReopened("rotated")
+		return newFile, true
+	}
+
+	// How far into the file we have read
+	position, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		log.Debug("Failed to get position in the file we're following: ", err)
+		return file, false
+	}
+
+	if current.Size() < position {
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			log.Debug("Failed to rewind truncated file: ", err)
+			return file, false
+		}
+
+		log.Debug("Followed file truncated, reading ", filename, " from the start")
+		reader.noteReopened("truncated")
+		return file, true
+	}
+
+	return file, false
+}
+
+func (reader *Reader) noteReopened(reason string) {
+	reader.Lock()
+	reader.reopenedReason = reason
+	reader.reopenedAt = time.Now()
+	reader.Unlock()
+
+	// Get the status bar updated
+	select {
+	case reader.moreLinesAdded <- true:
+	default:
+	}
+}
+
+// "rotated 14:02:59", or "" if the followed file has never been reopened.
+//
+// createReopenedStatusUnlocked() assumes that its caller is holding the lock
+func (reader *Reader) createReopenedStatusUnlocked() string {
+	if reader.reopenedReason == "" {
+		return ""
+	}
+
+	return reader.reopenedReason + " " + reader.reopenedAt.Format(time.TimeOnly)
+}
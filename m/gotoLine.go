@@ -1,45 +1,75 @@
 package m
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"strconv"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/walles/moar/twin"
 )
 
+// Shown when we can't make sense of what the user typed
+var errGotoSyntax = errors.New("try 42, 50%, +10, -10, $ or b1234")
+
 func (p *Pager) addGotoLineFooter() {
 	_, height := p.screen.Size()
 
 	pos := 0
-	for _, token := range "Go to line number: " + p.gotoLineString {
+	for _, token := range "Go to line number: " {
 		p.screen.SetCell(pos, height-1, twin.NewCell(token, twin.StyleDefault))
 		pos++
 	}
 
-	// Add a cursor
-	p.screen.SetCell(pos, height-1, twin.NewCell(' ', twin.StyleDefault.WithAttr(twin.AttrReverse)))
+	pos = p.gotoLineEditor.render(p.screen, pos, height-1)
+
+	if p.gotoLineError == "" {
+		return
+	}
+
+	pos++
+	for _, token := range p.gotoLineError {
+		p.screen.SetCell(pos, height-1, twin.NewCell(token, twin.StyleDefault.WithAttr(twin.AttrDim)))
+		pos++
+	}
 }
 
 func (p *Pager) onGotoLineKey(key twin.KeyCode) {
 	switch key {
 	case twin.KeyEnter:
-		newLineNumber, err := strconv.Atoi(p.gotoLineString)
-		if err == nil {
-			p.scrollPosition = NewScrollPositionFromLineNumberOneBased(newLineNumber, "onGotoLineKey")
+		if p.gotoLineEditor.text == "" {
+			p.mode = _Viewing
+			return
 		}
+
+		newLineNumber, err := p.parseGotoLine(p.gotoLineEditor.text)
+		if err != nil {
+			log.Debugf("Can't go to <%s>: %s", p.gotoLineEditor.text, err)
+			p.gotoLineError = err.Error()
+			return
+		}
+
+		p.pushJump()
+		p.scrollPosition = NewScrollPositionFromLineNumberOneBased(newLineNumber, "onGotoLineKey")
 		p.mode = _Viewing
 
 	case twin.KeyEscape:
 		p.mode = _Viewing
 
-	case twin.KeyBackspace, twin.KeyDelete:
-		if len(p.gotoLineString) == 0 {
+	default:
+		before := p.gotoLineEditor.text
+		if p.gotoLineEditor.onKey(key) {
+			if p.gotoLineEditor.text != before {
+				p.gotoLineError = ""
+			}
 			return
 		}
 
-		p.gotoLineString = removeLastChar(p.gotoLineString)
-
-	default:
 		log.Tracef("Unhandled goto key event %v, treating as a viewing key event", key)
 		p.mode = _Viewing
 		p.onKey(key)
@@ -53,18 +83,159 @@ func (p *Pager) onGotoLineRune(char rune) {
 	}
 
 	if char == 'g' {
+		p.pushJump()
 		p.scrollPosition = newScrollPosition("Pager scroll position")
 		p.handleScrolledUp()
 		p.mode = _Viewing
 		return
 	}
 
-	newGotoLineString := p.gotoLineString + string(char)
-	_, err := strconv.Atoi(newGotoLineString)
-	if err != nil {
-		log.Debugf("Got non-number goto rune '%s'/0x%08x: %s", string(char), int32(char), err)
-		return
+	// Accept anything here, parseGotoLine() will complain if needed
+	p.gotoLineEditor.onRune(char)
+	p.gotoLineError = ""
+}
+
+// Figure out which line the user wants to go to:
+//
+//	42     Line 42
+//	50%    Half way through
+//	+10    Ten lines down from the top of the screen
+//	-10    Ten lines up from the top of the screen
+//	$      The last line, same as -1
+//	b1234  The line containing byte offset 1234
+func (p *Pager) parseGotoLine(input string) (int, error) {
+	lineCount := p.reader.GetLineCount()
+
+	lineNumber := 0
+	switch {
+	case input == "$" || input == "-1":
+		lineNumber = lineCount
+
+	case strings.HasSuffix(input, "%"):
+		percent, err := strconv.Atoi(strings.TrimSuffix(input, "%"))
+		if err != nil {
+			return 0, errGotoSyntax
+		}
+		if percent < 0 || percent > 100 {
+			return 0, errors.New("percentages go from 0% to 100%")
+		}
+		lineNumber = lineCount * percent / 100
+
+	case strings.HasPrefix(input, "+"), strings.HasPrefix(input, "-"):
+		delta, err := strconv.Atoi(input)
+		if err != nil {
+			return 0, errGotoSyntax
+		}
+		lineNumber = p.lineNumberOneBased() + delta
+
+	case strings.HasPrefix(input, "b"):
+		offset, err := strconv.ParseInt(strings.TrimPrefix(input, "b"), 10, 64)
+		if err != nil || offset < 0 {
+			return 0, errGotoSyntax
+		}
+
+		reader := asReader(p.reader)
+		if reader == nil {
+			return 0, errors.New("byte offsets not available")
+		}
+		lineNumber, err = reader.lineNumberAtByteOffset(offset)
+		if err != nil {
+			return 0, err
+		}
+
+	default:
+		var err error
+		lineNumber, err = strconv.Atoi(input)
+		if err != nil {
+			return 0, errGotoSyntax
+		}
+	}
+
+	if lineNumber < 1 {
+		lineNumber = 1
+	}
+	return lineNumber, nil
+}
+
+// Find the line containing some byte of the input. Offsets are the same as in
+// the hex dump.
+func (reader *Reader) lineNumberAtByteOffset(offset int64) (int, error) {
+	reader.Lock()
+	hexDumpOf := reader.hexDumpOf
+	raw := reader.rawBytes
+	text := reader.text
+	sourceFile := reader.sourceFile
+	reader.Unlock()
+
+	if hexDumpOf != nil {
+		// One hex dump line per hexDumpBytesPerLine bytes
+		lineNumber := offset/hexDumpBytesPerLine + 1
+		if lineNumber > int64(reader.GetLineCount()) {
+			return 0, errPastEnd(offset)
+		}
+		return int(lineNumber), nil
+	}
+
+	if raw != nil {
+		raw.Lock()
+		defer raw.Unlock()
+		if offset >= int64(len(raw.bytes)) {
+			if raw.truncated {
+				return 0, fmt.Errorf("byte offset %d is past the first %sB of input, which is all we kept", offset, formatFileSize(int64(rawBytesLimit)))
+			}
+			return 0, errPastEnd(offset)
+		}
+		return bytes.Count(raw.bytes[:offset], []byte{'\n'}) + 1, nil
+	}
+
+	if text != nil {
+		if offset >= int64(len(*text)) {
+			return 0, errPastEnd(offset)
+		}
+		return strings.Count((*text)[:offset], "\n") + 1, nil
 	}
 
-	p.gotoLineString = newGotoLineString
+	if sourceFile != nil {
+		file, err := os.Open(*sourceFile)
+		if err != nil {
+			return 0, err
+		}
+		defer file.Close()
+
+		return countLinesBefore(file, offset)
+	}
+
+	return 0, errors.New("byte offsets not available")
+}
+
+// Count the lines before some offset in a file, plus one
+func countLinesBefore(file io.Reader, offset int64) (int, error) {
+	lineNumber := 1
+	buffer := make([]byte, bufio.MaxScanTokenSize)
+	remaining := offset
+	for {
+		count, err := file.Read(buffer)
+		chunk := buffer[:count]
+		if int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+			lineNumber += bytes.Count(chunk, []byte{'\n'})
+			return lineNumber, nil
+		}
+
+		lineNumber += bytes.Count(chunk, []byte{'\n'})
+		remaining -= int64(count)
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return 0, errPastEnd(offset)
+}
+
+func errPastEnd(offset int64) error {
+	return fmt.Errorf("byte offset %d is past the end", offset)
 }
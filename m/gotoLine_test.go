@@ -0,0 +1,125 @@
+package m
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func newGotoTestPager(t *testing.T, reader *Reader) *Pager {
+	assert.NilError(t, reader._wait())
+
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+	return pager
+}
+
+func hundredLines() string {
+	builder := strings.Builder{}
+	for i := 1; i <= 100; i++ {
+		builder.WriteString(fmt.Sprintf("Line %d\n", i))
+	}
+	return builder.String()
+}
+
+func assertGoto(t *testing.T, pager *Pager, input string, expectedLineNumber int) {
+	t.Helper()
+
+	lineNumber, err := pager.parseGotoLine(input)
+	assert.NilError(t, err, input)
+	assert.Equal(t, lineNumber, expectedLineNumber, input)
+}
+
+func TestGotoLine(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+	pager.scrollPosition = NewScrollPositionFromLineNumberOneBased(30, "TestGotoLine")
+
+	assertGoto(t, pager, "42", 42)
+	assertGoto(t, pager, "0", 1)
+
+	assertGoto(t, pager, "0%", 1)
+	assertGoto(t, pager, "50%", 50)
+	assertGoto(t, pager, "100%", 100)
+
+	assertGoto(t, pager, "+20", 50)
+	assertGoto(t, pager, "-20", 10)
+	assertGoto(t, pager, "-200", 1)
+
+	assertGoto(t, pager, "$", 100)
+	assertGoto(t, pager, "-1", 100)
+}
+
+func TestGotoLineInvalid(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+
+	for _, input := range []string{"x", "12x", "%", "+", "b", "b-5", "101%"} {
+		_, err := pager.parseGotoLine(input)
+		assert.Assert(t, err != nil, input)
+	}
+}
+
+func TestGotoByteOffset(t *testing.T) {
+	// "Line 1\n" is 7 bytes, so line 2 starts at offset 7
+	text := NewReaderFromText("text", hundredLines())
+	filename := t.TempDir() + "/hundred.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte(hundredLines()), 0o600))
+	file, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, err)
+
+	for _, reader := range []*Reader{text, file} {
+		pager := newGotoTestPager(t, reader)
+		assertGoto(t, pager, "b0", 1)
+		assertGoto(t, pager, "b6", 1)
+		assertGoto(t, pager, "b7", 2)
+		assertGoto(t, pager, "b63", 10)
+
+		_, err := pager.parseGotoLine("b100000")
+		assert.Error(t, err, "byte offset 100000 is past the end")
+	}
+
+	// We don't keep the bytes of text streams, see dropRawBytes()
+	stream := NewReaderFromStream("stream", strings.NewReader(hundredLines()), *styles.Get("native"), nil, nil)
+	pager := newGotoTestPager(t, stream)
+	_, err = pager.parseGotoLine("b7")
+	assert.ErrorContains(t, err, "byte offsets not available")
+}
+
+func TestGotoByteOffsetInHexDump(t *testing.T) {
+	reader := NewReaderFromText("hundred", hundredLines())
+	hexDump, _ := reader.getHexDump()
+	pager := newGotoTestPager(t, hexDump)
+
+	assertGoto(t, pager, "b0", 1)
+	assertGoto(t, pager, "b15", 1)
+	assertGoto(t, pager, "b16", 2)
+}
+
+func TestGotoLineFeedback(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+
+	pager.onRune('g')
+	pager.onRune('x')
+	pager.onKey(twin.KeyEnter)
+	assert.Equal(t, pager.mode, _GotoLine)
+
+	pager.redraw("")
+	screen := pager.screen.(*twin.FakeScreen)
+	assert.Equal(t,
+		rowToString(screen.GetRow(9)),
+		"Go to line number: x  "+errGotoSyntax.Error())
+
+	// Fix the typo and try again
+	pager.onKey(twin.KeyBackspace)
+	pager.onRune('5')
+	pager.onRune('0')
+	pager.onRune('%')
+	pager.onKey(twin.KeyEnter)
+	assert.Equal(t, pager.mode, _Viewing)
+	assert.Equal(t, pager.lineNumberOneBased(), 50)
+}
@@ -0,0 +1,450 @@
+package m
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const hexDumpBytesPerLine = 16
+
+// Does this look like the start of a binary file?
+//
+// NUL bytes, lots of control characters or lots of invalid UTF-8 means binary.
+// Call this after checking for UTF-16, which has lots of NULs.
+func looksBinary(start []byte) bool {
+	if len(start) == 0 {
+		return false
+	}
+
+	if bytes.IndexByte(start, 0) >= 0 {
+		return true
+	}
+
+	controlChars := 0
+	invalidBytes := 0
+	for remaining := start; len(remaining) > 0; {
+		char, size := utf8.DecodeRune(remaining)
+		remaining = remaining[size:]
+
+		if char == utf8.RuneError && size == 1 {
+			invalidBytes++
+			continue
+		}
+
+		switch char {
+		case '\t', '\n', '\r', '\f', '\v', '\b', '\x1b':
+			// These are all common in text files
+			continue
+		}
+		if char < ' ' || char == '\x7f' {
+			controlChars++
+		}
+	}
+
+	if controlChars*10 > len(start) {
+		return true
+	}
+
+	// Legacy 8 bit text, like Latin-1, has some invalid UTF-8, but not this
+	// much
+	return invalidBytes*2 > len(start)
+}
+
+// Format one line of hex dump, just like "hexdump -C" does:
+//
+// 00000000  48 65 6a 0a 00 01 02 03  04 05 06 07 08 09 0a 0b  |Hej.............|
+func formatHexDumpLine(offset int64, lineBytes []byte) string {
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("%08x  ", offset))
+
+	for i := 0; i < hexDumpBytesPerLine; i++ {
+		if i == hexDumpBytesPerLine/2 {
+			builder.WriteByte(' ')
+		}
+
+		if i < len(lineBytes) {
+			builder.WriteString(fmt.Sprintf("%02x ", lineBytes[i]))
+		} else {
+			// Keep the ASCII column aligned on the last line
+			builder.WriteString("   ")
+		}
+	}
+
+	builder.WriteString(" |")
+	for _, b := range lineBytes {
+		if b >= ' ' && b < '\x7f' {
+			builder.WriteByte(b)
+		} else {
+			builder.WriteByte('.')
+		}
+	}
+	builder.WriteByte('|')
+
+	return builder.String()
+}
+
+// Keeping a copy of everything we read from a stream doubles our memory usage,
+// so we stop after this many bytes. Also, we only keep the copy for binary
+// streams, see dropRawBytes().
+//
+// It's a variable so that the tests can change it.
+var rawBytesLimit = 16 * 1024 * 1024
+
+// Returned instead of io.EOF by rawBytes readers when rawBytesLimit was hit
+var errRawBytesTruncated = errors.New("input truncated")
+
+// What we have read from a stream, so that we can make a hex dump of it.
+//
+// Files don't need this, since we can just read them again.
+type rawBytes struct {
+	sync.Mutex
+	changed *sync.Cond
+
+	bytes  []byte
+	closed bool
+
+	// Set if we got more than rawBytesLimit bytes, and dropped the rest
+	truncated bool
+}
+
+func newRawBytes() *rawBytes {
+	returnMe := &rawBytes{}
+	returnMe.changed = sync.NewCond(returnMe)
+	return returnMe
+}
+
+func (raw *rawBytes) Write(p []byte) (int, error) {
+	raw.Lock()
+	if raw.closed {
+		// Dropped, see dropRawBytes()
+		raw.Unlock()
+		return len(p), nil
+	}
+
+	keep := p
+	if room := rawBytesLimit - len(raw.bytes); len(keep) > room {
+		keep = keep[:room]
+		raw.truncated = true
+	}
+	raw.bytes = append(raw.bytes, keep...)
+	raw.Unlock()
+
+	raw.changed.Broadcast()
+	return len(p), nil
+}
+
+// No more bytes will be written after this
+func (raw *rawBytes) close() {
+	raw.Lock()
+	raw.closed = true
+	raw.Unlock()
+
+	raw.changed.Broadcast()
+}
+
+// Forget all bytes, and don't keep any new ones either
+func (raw *rawBytes) drop() {
+	raw.Lock()
+	raw.bytes = nil
+	raw.truncated = true
+	raw.closed = true
+	raw.Unlock()
+
+	raw.changed.Broadcast()
+}
+
+// Text streams are shown as text, so there's no need to keep a copy of their
+// bytes for hex dumping. Call this when we know the stream isn't binary.
+//
+// If the user already asked for a hex dump, we keep the bytes for that.
+func (reader *Reader) dropRawBytes() {
+	reader.Lock()
+	raw := reader.rawBytes
+	if reader.hexDump != nil {
+		raw = nil
+	} else {
+		reader.rawBytes = nil
+	}
+	reader.Unlock()
+
+	if raw != nil {
+		raw.drop()
+	}
+}
+
+// Read all bytes from the start. Reads will block waiting for more bytes until
+// close() has been called.
+//
+// If we dropped bytes because of rawBytesLimit, the last Read() will return
+// errRawBytesTruncated rather than io.EOF.
+func (raw *rawBytes) newReader() io.Reader {
+	return &rawBytesReader{source: raw}
+}
+
+type rawBytesReader struct {
+	source *rawBytes
+	offset int
+}
+
+func (r *rawBytesReader) Read(p []byte) (int, error) {
+	r.source.Lock()
+	defer r.source.Unlock()
+
+	for r.offset >= len(r.source.bytes) && !r.source.closed {
+		r.source.changed.Wait()
+	}
+
+	if r.offset >= len(r.source.bytes) {
+		if r.source.truncated {
+			return 0, errRawBytesTruncated
+		}
+		return 0, io.EOF
+	}
+
+	count := copy(p, r.source.bytes[r.offset:])
+	r.offset += count
+	return count, nil
+}
+
+// Get the hex dump of this Reader's contents, creating it if needed.
+//
+// The second return value is true if the hex dump was created by this call.
+// The hex dump Reader is nil if we can't make a hex dump of this Reader.
+func (reader *Reader) getHexDump() (*Reader, bool) {
+	reader.Lock()
+	defer reader.Unlock()
+
+	if reader.hexDump != nil {
+		return reader.hexDump, false
+	}
+
+	if reader.lazy != nil {
+		// Large file, make the hex dump lazily as well
+		hexDump, err := newLazyHexDumpReader(reader.name, *reader.sourceFile)
+		if err != nil {
+			log.Warn("Failed to open file for hex dumping: ", err)
+			return nil, false
+		}
+		reader.hexDump = hexDump
+		reader.hexDump.hexDumpOf = reader
+		return reader.hexDump, true
+	}
+
+	var source io.Reader
+	if reader.rawBytes != nil {
+		source = reader.rawBytes.newReader()
+	} else if reader.text != nil {
+		source = strings.NewReader(*reader.text)
+	} else if reader.sourceFile != nil {
+		file, err := os.Open(*reader.sourceFile)
+		if err != nil {
+			log.Warn("Failed to open file for hex dumping: ", err)
+			return nil, false
+		}
+		source = file
+	} else {
+		log.Debug("No bytes available for hex dumping")
+		return nil, false
+	}
+
+	reader.hexDump = newHexDumpReader(reader.name, source, reader.following)
+	reader.hexDump.hexDumpOf = reader
+
+	return reader.hexDump, true
+}
+
+func newHexDumpReader(name *string, source io.Reader, following bool) *Reader {
+	done := atomic.Bool{}
+	done.Store(false)
+	highlightingDone := atomic.Bool{}
+	highlightingDone.Store(true) // No highlighting to do == nothing left == Done!
+	returnMe := Reader{
+		name:             name,
+		moreLinesAdded:   make(chan bool, 1),
+		maybeDone:        make(chan bool, 1),
+		highlightingDone: &highlightingDone,
+		done:             &done,
+		following:        following,
+	}
+
+	go returnMe.readHexDump(source)
+
+	return &returnMe
+}
+
+// This function will be update the Reader struct in the background.
+func (reader *Reader) readHexDump(source io.Reader) {
+	defer reader.cleanupFilter(nil)
+	defer func() {
+		closer, ok := source.(io.Closer)
+		if !ok {
+			return
+		}
+		if err := closer.Close(); err != nil {
+			log.Debug("Failed to close hex dump source: ", err)
+		}
+	}()
+
+	buffer := make([]byte, 64*1024)
+	lineBytes := make([]byte, 0, hexDumpBytesPerLine)
+	var lineOffset int64
+
+	// Just like readStream(), we show incomplete lines as soon as we get them,
+	// and replace them when we get more bytes.
+	lastLineIsPartial := false
+
+	for {
+		count, err := source.Read(buffer)
+		newBytes := buffer[:count]
+
+		for len(newBytes) > 0 {
+			wanted := hexDumpBytesPerLine - len(lineBytes)
+			if wanted > len(newBytes) {
+				wanted = len(newBytes)
+			}
+			lineBytes = append(lineBytes, newBytes[:wanted]...)
+			newBytes = newBytes[wanted:]
+
+			if len(lineBytes) < hexDumpBytesPerLine {
+				break
+			}
+
+			if !reader.addLine([]byte(formatHexDumpLine(lineOffset, lineBytes)), lastLineIsPartial) {
+				return
+			}
+			lastLineIsPartial = false
+			lineOffset += hexDumpBytesPerLine
+			lineBytes = lineBytes[:0]
+		}
+
+		if count > 0 && len(lineBytes) > 0 {
+			if !reader.addLine([]byte(formatHexDumpLine(lineOffset, lineBytes)), lastLineIsPartial) {
+				return
+			}
+			lastLineIsPartial = true
+		}
+
+		if err == nil {
+			continue
+		}
+
+		if err == errRawBytesTruncated {
+			reader.addLine([]byte(fmt.Sprintf(
+				"[Hex view ends here, only the first %sB of input were kept]",
+				formatFileSize(int64(rawBytesLimit)))), false)
+			return
+		}
+
+		if err != io.EOF {
+			reader.Lock()
+			if reader.err == nil {
+				reader.err = fmt.Errorf("error reading input for hex dump: %w", err)
+			}
+			reader.Unlock()
+			return
+		}
+
+		if !reader.following {
+			return
+		}
+
+		time.Sleep(followPollInterval)
+		if reader.stopped.Load() {
+			return
+		}
+	}
+}
+
+// Toggle between the text view and the hex dump view of the current file
+func (p *Pager) toggleHexView() {
+	if p.isShowingHelp {
+		return
+	}
+
+	reader := asReader(p.reader)
+	if reader == nil {
+		// We only know how to hex dump our own Readers
+		return
+	}
+
+	var other *Reader
+	if reader.hexDumpOf != nil {
+		other = reader.hexDumpOf
+	} else {
+		hexDump, created := reader.getHexDump()
+		if hexDump == nil {
+			p.setStatusMessage("Hex view not available for this input")
+			return
+		}
+		if created {
+			p.watchReader(hexDump)
+		}
+		other = hexDump
+	}
+
+	// Remember where we were in this view so that we can get back there
+	if p.viewPositions == nil {
+		p.viewPositions = map[*Reader]scrollPosition{}
+	}
+	p.viewPositions[reader] = p.scrollPosition
+
+	p.reader = other
+	p.leftColumnZeroBased = 0
+
+	position, found := p.viewPositions[other]
+	if !found {
+		position = newScrollPosition("Pager hex view")
+	}
+	p.scrollPosition = position
+}
+
+// Binary files get switched into the hex view when we notice they are binary.
+// Only once per file though, after that the user decides.
+func (p *Pager) maybeSwitchToHexView() {
+	if p.isShowingHelp {
+		return
+	}
+
+	reader := asReader(p.reader)
+	if reader == nil || reader.hexDumpOf != nil {
+		return
+	}
+
+	if !reader.binary.Load() {
+		return
+	}
+
+	if p.hexViewChecked == nil {
+		p.hexViewChecked = map[*Reader]bool{}
+	}
+	if p.hexViewChecked[reader] {
+		return
+	}
+	p.hexViewChecked[reader] = true
+
+	log.Debug("Binary input detected, switching to hex view")
+	p.toggleHexView()
+}
+
+// Stop our hex dump, if we have one. Asking for a hex dump after this will
+// create a new one.
+func (reader *Reader) stopHexDump() {
+	reader.Lock()
+	hexDump := reader.hexDump
+	reader.hexDump = nil
+	reader.Unlock()
+
+	if hexDump != nil {
+		hexDump.stop()
+	}
+}
@@ -0,0 +1,152 @@
+package m
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func TestLooksBinary(t *testing.T) {
+	assert.Assert(t, !looksBinary([]byte{}))
+	assert.Assert(t, !looksBinary([]byte("hello\n")))
+	assert.Assert(t, !looksBinary([]byte("r\xc3\xa4ksm\xc3\xb6rg\xc3\xa5s\n")))
+	assert.Assert(t, !looksBinary([]byte("\x1b[1mbold\x1b[m B\bBS\bS\r\n")))
+
+	// Latin-1
+	assert.Assert(t, !looksBinary([]byte("r\xe4ksm\xf6rg\xe5s\n")))
+
+	assert.Assert(t, looksBinary([]byte("hello\x00")))
+	assert.Assert(t, looksBinary([]byte("\x7fELF\x02\x01\x01\x03\x04\xff\xfe\x80")))
+}
+
+func TestFormatHexDumpLine(t *testing.T) {
+	assert.Equal(t,
+		formatHexDumpLine(0x10, []byte("Hej\n\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b")),
+		"00000010  48 65 6a 0a 00 01 02 03  04 05 06 07 08 09 0a 0b  |Hej.............|")
+
+	// Partial lines should have their ASCII column aligned with the full ones
+	assert.Equal(t,
+		formatHexDumpLine(0x20, []byte("Hej")),
+		"00000020  48 65 6a                                          |Hej|")
+}
+
+func TestHexDumpStream(t *testing.T) {
+	reader := NewReaderFromStream("", strings.NewReader("0123456789abcdef\x00\xff"), *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, reader._wait())
+	assert.Assert(t, reader.binary.Load())
+
+	hexDump, created := reader.getHexDump()
+	assert.Assert(t, created)
+	assert.NilError(t, hexDump._wait())
+	assert.Equal(t, hexDump.GetLineCount(), 2)
+	assert.Equal(t, hexDump.GetLine(1).Plain(nil), "00000000  30 31 32 33 34 35 36 37  38 39 61 62 63 64 65 66  |0123456789abcdef|")
+	assert.Equal(t, hexDump.GetLine(2).Plain(nil), "00000010  00 ff                                             |..|")
+
+	// Asking again should give us the same hex dump
+	again, created := reader.getHexDump()
+	assert.Assert(t, !created)
+	assert.Equal(t, again, hexDump)
+}
+
+// We shouldn't keep unlimited amounts of stream input around for hex dumping
+func TestHexDumpStreamTruncated(t *testing.T) {
+	defer func(limit int) { rawBytesLimit = limit }(rawBytesLimit)
+	rawBytesLimit = 20
+
+	reader := NewReaderFromStream("", strings.NewReader("0123456789abcdef\n\x00123456789abcdef\n"), *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, reader._wait())
+	assert.Equal(t, reader.GetLineCount(), 2)
+
+	hexDump, _ := reader.getHexDump()
+	assert.NilError(t, hexDump._wait())
+	assert.Equal(t, hexDump.GetLineCount(), 3)
+	assert.Equal(t, hexDump.GetLine(2).Plain(nil), "00000010  0a 00 31 32                                       |..12|")
+	assert.Equal(t, hexDump.GetLine(3).Plain(nil), "[Hex view ends here, only the first 20B of input were kept]")
+
+	_, err := reader.lineNumberAtByteOffset(25)
+	assert.ErrorContains(t, err, "which is all we kept")
+}
+
+// Text streams are shown as text, so we shouldn't keep their bytes around
+func TestHexDumpTextStream(t *testing.T) {
+	reader := NewReaderFromStream("", strings.NewReader("hej\n"), *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, reader._wait())
+	assert.Assert(t, reader.rawBytes == nil)
+
+	hexDump, _ := reader.getHexDump()
+	assert.Assert(t, hexDump == nil)
+
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+	pager.onRune('x')
+	assert.Equal(t, pager.reader, LineSource(reader))
+	assert.Equal(t, pager.getStatusMessage(), "Hex view not available for this input")
+}
+
+func TestHexDumpText(t *testing.T) {
+	reader := NewReaderFromText("", "\nhej\n")
+	assert.Assert(t, reader.rawBytes == nil)
+
+	hexDump, _ := reader.getHexDump()
+	assert.NilError(t, hexDump._wait())
+	assert.Equal(t, hexDump.GetLine(1).Plain(nil), "00000000  0a 68 65 6a 0a                                    |.hej.|")
+
+	lineNumber, err := reader.lineNumberAtByteOffset(2)
+	assert.NilError(t, err)
+	assert.Equal(t, lineNumber, 2)
+}
+
+func TestHexDumpFile(t *testing.T) {
+	filename := t.TempDir() + "/text.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte("text\r\n"), 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+	assert.Assert(t, !reader.binary.Load())
+
+	// The hex dump should show the bytes of the file, including the CR
+	hexDump, _ := reader.getHexDump()
+	assert.NilError(t, hexDump._wait())
+	assert.Equal(t, hexDump.GetLine(1).Plain(nil), "00000000  74 65 78 74 0d 0a                                 |text..|")
+}
+
+func TestToggleHexView(t *testing.T) {
+	reader := NewReaderFromText("text", "hello")
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+	pager.scrollPosition = NewScrollPositionFromLineNumberOneBased(1, "TestToggleHexView")
+
+	pager.onRune('x')
+	assert.Equal(t, pager.reader.(*Reader).hexDumpOf, reader)
+	assert.NilError(t, pager.reader.(*Reader)._wait())
+	assert.Equal(t, pager.reader.GetLine(1).Plain(nil), "00000000  68 65 6c 6c 6f                                    |hello|")
+
+	// Search should work in the hex view
+	pager.searchPattern = toPattern("6c 6c")
+	assert.Assert(t, pager.findFirstHit(newScrollPosition("TestToggleHexView"), false) != nil)
+
+	pager.onRune('x')
+	assert.Equal(t, pager.reader, reader)
+}
+
+func TestBinaryInputSwitchesToHexView(t *testing.T) {
+	reader := NewReaderFromStream("", strings.NewReader("\x00\x01\x02"), *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, reader._wait())
+
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+
+	pager.maybeSwitchToHexView()
+	assert.Equal(t, pager.reader.(*Reader).hexDumpOf, reader)
+
+	// Going back to the text view should stick
+	pager.onRune('x')
+	pager.maybeSwitchToHexView()
+	assert.Equal(t, pager.reader, reader)
+}
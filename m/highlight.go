@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/alecthomas/chroma/v2"
+	log "github.com/sirupsen/logrus"
 )
 
 // Read and highlight some text using Chroma:
@@ -54,3 +55,33 @@ func highlight(text string, style chroma.Style, formatter chroma.Formatter, lexe
 
 	return &trimmed, nil
 }
+
+// Highlight some lines. Returns nil if highlighting would be a no-op or failed.
+func highlightLines(lines []*Line, style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer) []*Line {
+	textBuilder := strings.Builder{}
+	for _, line := range lines {
+		textBuilder.WriteString(line.raw)
+		textBuilder.WriteString("\n")
+	}
+
+	highlighted, err := highlight(textBuilder.String(), style, formatter, lexer)
+	if err != nil {
+		log.Warn("Highlighting failed: ", err)
+		return nil
+	}
+
+	if highlighted == nil {
+		// No highlighting would be done, never mind
+		return nil
+	}
+
+	highlightedLines := linesFromText(*highlighted)
+	if len(highlightedLines) != len(lines) {
+		// We'd rather show the lines unhighlighted than get them out of
+		// order with the line numbers
+		log.Debug("Highlighting turned ", len(lines), " lines into ", len(highlightedLines), ", ignoring")
+		return nil
+	}
+
+	return highlightedLines
+}
@@ -0,0 +1,283 @@
+package m
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Don't remember more searches than this
+const maxSearchHistoryLength = 100
+
+// Don't remember positions in more files than this
+const maxRememberedPositions = 100
+
+// What we remember between sessions, see Pager.StateFile
+type _State struct {
+	Searches  []string                 `json:"searches,omitempty"`
+	Positions map[string]_FilePosition `json:"positions,omitempty"`
+}
+
+type _FilePosition struct {
+	LineNumberOneBased int       `json:"line"`
+	LastViewed         time.Time `json:"lastViewed"`
+}
+
+// DefaultStateFile returns where moar remembers search history and file
+// positions between sessions. Follows the XDG Base Directory Specification.
+// Returns "" if we can't find a good place.
+func DefaultStateFile() string {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if !filepath.IsAbs(stateHome) {
+		// Relative paths are invalid according to the spec, ignore them
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Debug("No home directory, not remembering anything: ", err)
+			return ""
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+
+	return filepath.Join(stateHome, "moar", "state.json")
+}
+
+// Returns an empty state if the file doesn't exist
+func loadState(filename string) (_State, error) {
+	state := _State{}
+
+	bytes, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+
+	err = json.Unmarshal(bytes, &state)
+	return state, err
+}
+
+func saveState(filename string, state _State) error {
+	bytes, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Search strings can be private, keep them to ourselves
+	err = os.MkdirAll(filepath.Dir(filename), 0o700)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it, so that concurrent moar
+	// sessions never see a half written file
+	tempFile, err := os.CreateTemp(filepath.Dir(filename), ".state-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write(bytes)
+	closeErr := tempFile.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	return os.Rename(tempFile.Name(), filename)
+}
+
+// Add a search string to the end of a history, removing any earlier copies of
+// it
+func appendSearch(history []string, search string) []string {
+	newHistory := make([]string, 0, len(history)+1)
+	for _, old := range history {
+		if old != search {
+			newHistory = append(newHistory, old)
+		}
+	}
+	newHistory = append(newHistory, search)
+
+	if len(newHistory) > maxSearchHistoryLength {
+		newHistory = newHistory[len(newHistory)-maxSearchHistoryLength:]
+	}
+	return newHistory
+}
+
+// Forget about the least recently viewed files if we remember too many
+func trimPositions(positions map[string]_FilePosition) {
+	if len(positions) <= maxRememberedPositions {
+		return
+	}
+
+	filenames := make([]string, 0, len(positions))
+	for filename := range positions {
+		filenames = append(filenames, filename)
+	}
+	sort.Slice(filenames, func(i, j int) bool {
+		return positions[filenames[i]].LastViewed.After(positions[filenames[j]].LastViewed)
+	})
+
+	for _, filename := range filenames[maxRememberedPositions:] {
+		delete(positions, filename)
+	}
+}
+
+// The name we remember a position under, or "" if this isn't a file we should
+// remember positions in
+func positionKey(source LineSource) string {
+	reader := asReader(source)
+	if reader == nil {
+		return ""
+	}
+
+	reader.Lock()
+	defer reader.Unlock()
+	if reader.reopen == nil || reader.shellCommand != "" || reader.listing != nil || reader.name == nil {
+		// Not a file
+		return ""
+	}
+
+	absolute, err := filepath.Abs(*reader.name)
+	if err != nil {
+		return ""
+	}
+	return absolute
+}
+
+// Load search history, and offer to resume where the user was last time
+func (p *Pager) loadHistory() {
+	if p.StateFile == "" {
+		return
+	}
+
+	state, err := loadState(p.StateFile)
+	if err != nil {
+		log.Info("Failed to load state from ", p.StateFile, ": ", err)
+		return
+	}
+	p.searchHistory = state.Searches
+
+	if p.TargetLineNumberOneBased != 0 || p.initialSearchNextLine != 0 {
+		// The user already told us where to go
+		return
+	}
+
+	key := positionKey(p.reader)
+	if key == "" {
+		return
+	}
+	position, found := state.Positions[key]
+	if found && position.LineNumberOneBased > 1 {
+		p.resumeLineNumberOneBased = position.LineNumberOneBased
+	}
+}
+
+// Remember this session's searches and where we were in each file. Changes
+// are merged into what's in the file, in case other moar sessions have
+// updated it since we started.
+func (p *Pager) saveHistory() {
+	if p.StateFile == "" {
+		return
+	}
+
+	if p.isShowingHelp {
+		// Get back to where the user was before asking for help
+		p.Quit()
+	}
+
+	state, err := loadState(p.StateFile)
+	if err != nil {
+		log.Info("Failed to load state from ", p.StateFile, ", starting over: ", err)
+		state = _State{}
+	}
+
+	for _, search := range p.newSearches {
+		state.Searches = appendSearch(state.Searches, search)
+	}
+
+	if state.Positions == nil {
+		state.Positions = map[string]_FilePosition{}
+	}
+	now := time.Now()
+	p.saveFileState()
+	currentFileIndex := p.currentFileIndex
+	for i := range p.files {
+		p.loadFileState(i)
+		key := positionKey(p.reader)
+		if key == "" {
+			continue
+		}
+		state.Positions[key] = _FilePosition{
+			LineNumberOneBased: p.lineNumberOneBased(),
+			LastViewed:         now,
+		}
+	}
+	p.loadFileState(currentFileIndex)
+	trimPositions(state.Positions)
+
+	err = saveState(p.StateFile, state)
+	if err != nil {
+		log.Info("Failed to save state to ", p.StateFile, ": ", err)
+	}
+}
+
+// Remember a search for the next session
+func (p *Pager) addToSearchHistory(search string) {
+	if search == "" {
+		return
+	}
+
+	p.searchHistory = appendSearch(p.searchHistory, search)
+	p.newSearches = append(p.newSearches, search)
+}
+
+// Up arrow in the search prompt, show the previous search
+func (p *Pager) previousSearchFromHistory() {
+	if p.searchHistoryIndex <= 0 {
+		return
+	}
+
+	if p.searchHistoryIndex == len(p.searchHistory) {
+		// Don't lose what the user was typing
+		p.searchDraft = p.searchEditor.text
+	}
+
+	p.searchHistoryIndex--
+	p.searchEditor.setText(p.searchHistory[p.searchHistoryIndex])
+	p.updateSearchPattern()
+}
+
+// Down arrow in the search prompt, undoes previousSearchFromHistory()
+func (p *Pager) nextSearchFromHistory() {
+	if p.searchHistoryIndex >= len(p.searchHistory) {
+		return
+	}
+
+	p.searchHistoryIndex++
+	if p.searchHistoryIndex == len(p.searchHistory) {
+		p.searchEditor.setText(p.searchDraft)
+	} else {
+		p.searchEditor.setText(p.searchHistory[p.searchHistoryIndex])
+	}
+	p.updateSearchPattern()
+}
+
+// 'r', go to where the user was last time they looked at this file
+func (p *Pager) resume() {
+	if p.resumeLineNumberOneBased == 0 {
+		return
+	}
+
+	p.pushJump()
+	p.scrollPosition = NewScrollPositionFromLineNumberOneBased(p.resumeLineNumberOneBased, "resume")
+	p.handleScrolledUp()
+	p.resumeLineNumberOneBased = 0
+}
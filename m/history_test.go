@@ -0,0 +1,179 @@
+package m
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func TestSearchHistoryBrowsing(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+	pager.searchHistory = []string{"one", "two"}
+
+	typeRunes(pager, "/dr")
+
+	pager.onKey(twin.KeyUp)
+	assert.Equal(t, pager.searchEditor.text, "two")
+	pager.onKey(twin.KeyUp)
+	assert.Equal(t, pager.searchEditor.text, "one")
+	pager.onKey(twin.KeyUp)
+	assert.Equal(t, pager.searchEditor.text, "one")
+
+	pager.onKey(twin.KeyDown)
+	assert.Equal(t, pager.searchEditor.text, "two")
+	pager.onKey(twin.KeyDown)
+	assert.Equal(t, pager.searchEditor.text, "dr")
+	pager.onKey(twin.KeyDown)
+	assert.Equal(t, pager.searchEditor.text, "dr")
+	assert.Equal(t, pager.mode, _Searching)
+
+	// Searching for something old again moves it last
+	pager.onKey(twin.KeyUp)
+	pager.onKey(twin.KeyUp)
+	pager.onKey(twin.KeyEnter)
+	assert.DeepEqual(t, pager.searchHistory, []string{"two", "one"})
+	assert.DeepEqual(t, pager.newSearches, []string{"one"})
+}
+
+func openHundredLinesFile(t *testing.T, filename string) *Pager {
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, err)
+	return newGotoTestPager(t, reader)
+}
+
+func TestRememberPositionAndSearches(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "moar", "state.json")
+	filename := filepath.Join(t.TempDir(), "hundred.txt")
+	assert.NilError(t, os.WriteFile(filename, []byte(hundredLines()), 0o600))
+
+	// First session
+	pager := openHundredLinesFile(t, filename)
+	pager.StateFile = stateFile
+	pager.loadHistory()
+	assert.Equal(t, pager.resumeLineNumberOneBased, 0)
+	typeRunes(pager, "/Line 7")
+	pager.onKey(twin.KeyEnter)
+	gotoLine(pager, "42")
+	pager.saveHistory()
+
+	// Second session
+	pager = openHundredLinesFile(t, filename)
+	pager.StateFile = stateFile
+	pager.Quit()
+	pager.StartPaging(pager.screen, nil, nil)
+	assert.DeepEqual(t, pager.searchHistory, []string{"Line 7"})
+	assert.Equal(t, pager.resumeLineNumberOneBased, 42)
+
+	pager.redraw("")
+	screen := pager.screen.(*twin.FakeScreen)
+	assert.Equal(t, rowToString(screen.GetRow(9)), "hundred.txt: 100 lines  9%  Press 'r' to resume at line 42")
+
+	typeRunes(pager, "r")
+	assert.Equal(t, pager.lineNumberOneBased(), 42)
+	assert.Equal(t, pager.resumeLineNumberOneBased, 0)
+}
+
+func TestResumeOfferExpires(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+	pager.resumeLineNumberOneBased = 42
+	pager.redraw("")
+
+	typeRunes(pager, "j")
+	pager.redraw("")
+	typeRunes(pager, "r")
+	assert.Equal(t, pager.lineNumberOneBased(), 2)
+
+	pager.resumeLineNumberOneBased = 42
+	pager.onKey(twin.KeyDown)
+	pager.redraw("")
+	typeRunes(pager, "r")
+	assert.Equal(t, pager.lineNumberOneBased(), 3)
+}
+
+// The history should be saved however we exit
+func TestSaveHistoryOnExitEvent(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+	pager.StateFile = stateFile
+	pager.addToSearchHistory("exit")
+
+	screen := eventfulScreen{
+		FakeScreen: twin.NewFakeScreen(80, 10),
+		events:     make(chan twin.Event, 10),
+	}
+	screen.events <- twin.EventExit{}
+	pager.StartPaging(screen, nil, nil)
+
+	state, err := loadState(stateFile)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, state.Searches, []string{"exit"})
+}
+
+// Concurrent sessions shouldn't overwrite each other's searches
+func TestMergeSearchHistory(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	first := newGotoTestPager(t, NewReaderFromText("first", hundredLines()))
+	first.StateFile = stateFile
+	first.loadHistory()
+
+	second := newGotoTestPager(t, NewReaderFromText("second", hundredLines()))
+	second.StateFile = stateFile
+	second.loadHistory()
+
+	first.addToSearchHistory("first")
+	first.saveHistory()
+	second.addToSearchHistory("second")
+	second.saveHistory()
+
+	state, err := loadState(stateFile)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, state.Searches, []string{"first", "second"})
+}
+
+func TestNoStateFile(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+	pager.addToSearchHistory("secret")
+	pager.saveHistory() // Should do nothing
+	pager.loadHistory() // Should do nothing
+
+	assert.DeepEqual(t, pager.searchHistory, []string{"secret"})
+}
+
+func TestDefaultStateFile(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/xdg/state")
+	assert.Equal(t, DefaultStateFile(), "/xdg/state/moar/state.json")
+
+	// Relative paths should be ignored according to the XDG spec
+	t.Setenv("XDG_STATE_HOME", "relative")
+	t.Setenv("HOME", "/home/johan")
+	assert.Equal(t, DefaultStateFile(), "/home/johan/.local/state/moar/state.json")
+}
+
+func TestTrimPositions(t *testing.T) {
+	positions := map[string]_FilePosition{}
+	start := time.Now()
+	for i := 0; i < maxRememberedPositions+5; i++ {
+		positions[fmt.Sprint(i)] = _FilePosition{
+			LineNumberOneBased: i,
+			LastViewed:         start.Add(time.Duration(i) * time.Second),
+		}
+	}
+
+	trimPositions(positions)
+	assert.Equal(t, len(positions), maxRememberedPositions)
+
+	// The oldest ones should be gone
+	_, found := positions["4"]
+	assert.Assert(t, !found)
+	_, found = positions["5"]
+	assert.Assert(t, found)
+}
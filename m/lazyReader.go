@@ -0,0 +1,344 @@
+package m
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/alecthomas/chroma/v2"
+	log "github.com/sirupsen/logrus"
+)
+
+// Regular files larger than this are read lazily. Rather than keeping all
+// lines in memory, we index where the lines start and read them from the file
+// when somebody asks for them.
+//
+// It's a variable so that the tests can change it.
+var lazyReadingThreshold int64 = 64 * 1024 * 1024
+
+// We store the start offset of every lazyIndexStride'th line. Lines are then
+// read and cached in blocks of this many lines.
+const lazyIndexStride = 256
+
+// How many blocks of parsed lines to keep in memory. With 256 lines per block,
+// this is a bit more than 16k lines.
+const lazyCacheBlocks = 64
+
+// Lines of a file, read on demand. All accesses must be done while holding the
+// owning Reader's lock.
+type lazyLines struct {
+	file *os.File
+
+	// offsets[n] is where zero based line number n*lazyIndexStride starts
+	offsets []int64
+
+	// Number of lines indexed so far
+	lineCount int
+
+	// If set, lines are hex dump lines of hexDumpBytesPerLine bytes each,
+	// and there are no offsets. See newLazyHexDumpReader().
+	hexDump bool
+
+	// For highlighting blocks as we read them. No highlighting if lexer is nil.
+	style     chroma.Style
+	formatter chroma.Formatter
+	lexer     chroma.Lexer
+
+	// Block number -> element with a *lazyBlock value. Most recently used
+	// blocks are at the front of cacheOrder.
+	cache      map[int]*list.Element
+	cacheOrder *list.List
+}
+
+type lazyBlock struct {
+	number int
+	lines  []*Line
+}
+
+func newLazyReader(file *os.File, filename string, style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer) *Reader {
+	done := atomic.Bool{}
+	done.Store(false)
+	highlightingDone := atomic.Bool{}
+	highlightingDone.Store(true) // We highlight on demand, nothing to do up front
+	returnMe := Reader{
+		name:             &filename,
+		moreLinesAdded:   make(chan bool, 1),
+		maybeDone:        make(chan bool, 1),
+		highlightingDone: &highlightingDone,
+		done:             &done,
+		sourceFile:       &filename,
+		lazy: &lazyLines{
+			file:       file,
+			offsets:    []int64{0},
+			cache:      map[int]*list.Element{},
+			cacheOrder: list.New(),
+			style:      style,
+			formatter:  formatter,
+			lexer:      lexer,
+		},
+	}
+
+	start := make([]byte, encodingSniffSize)
+	byteCount, _ := file.ReadAt(start, 0)
+	if looksBinary(start[:byteCount]) {
+		log.Debug("Input looks binary")
+		returnMe.binary.Store(true)
+	}
+
+	go returnMe.indexLines()
+
+	return &returnMe
+}
+
+// Hex dump a large file, making lines on demand from file offsets.
+func newLazyHexDumpReader(name *string, filename string) (*Reader, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	done := atomic.Bool{}
+	done.Store(true) // Nothing to index, we know where all lines are
+	highlightingDone := atomic.Bool{}
+	highlightingDone.Store(true) // No highlighting to do == nothing left == Done!
+	returnMe := Reader{
+		name:             name,
+		moreLinesAdded:   make(chan bool, 1),
+		maybeDone:        make(chan bool, 1),
+		highlightingDone: &highlightingDone,
+		done:             &done,
+		lazy: &lazyLines{
+			file:       file,
+			hexDump:    true,
+			lineCount:  int((fileInfo.Size() + hexDumpBytesPerLine - 1) / hexDumpBytesPerLine),
+			cache:      map[int]*list.Element{},
+			cacheOrder: list.New(),
+		},
+	}
+	returnMe.reportMaybeDone()
+
+	return &returnMe, nil
+}
+
+// Find out where all lines start. Works like countLines(), but records line
+// start offsets as it goes.
+//
+// This function will be update the Reader struct in the background.
+func (reader *Reader) indexLines() {
+	defer reader.cleanupFilter(nil)
+
+	reader.Lock()
+	file := reader.lazy.file
+	reader.Unlock()
+
+	t0 := time.Now().UnixNano()
+	buf := make([]byte, bufio.MaxScanTokenSize)
+	var bufferOffset int64
+	lineCount := 0
+	lastReadEndsInNewline := true
+	for {
+		// ReadAt() doesn't move the file position, so this won't interfere
+		// with reading lines on demand
+		bufferSize, err := file.ReadAt(buf, bufferOffset)
+		if reader.stopped.Load() {
+			log.Debug("Reader stopped, not indexing any more lines")
+			return
+		}
+		if err != nil && err != io.EOF {
+			reader.Lock()
+			if reader.err == nil {
+				reader.err = fmt.Errorf("error indexing lines: %w", err)
+			}
+			reader.Unlock()
+			return
+		}
+
+		var newOffsets []int64
+		for scanMe := buf[:bufferSize]; len(scanMe) > 0; {
+			newlineIndex := bytes.IndexByte(scanMe, '\n')
+			if newlineIndex < 0 {
+				break
+			}
+
+			lineCount++
+			scanMe = scanMe[newlineIndex+1:]
+			if lineCount%lazyIndexStride == 0 {
+				newOffsets = append(newOffsets, bufferOffset+int64(bufferSize-len(scanMe)))
+			}
+		}
+
+		if bufferSize > 0 {
+			lastReadEndsInNewline = buf[bufferSize-1] == '\n'
+		}
+		bufferOffset += int64(bufferSize)
+
+		eof := err == io.EOF
+		if eof && !lastReadEndsInNewline {
+			// No trailing line feed, the last line is done anyway
+			lineCount++
+		}
+
+		reader.Lock()
+		reader.lazy.offsets = append(reader.lazy.offsets, newOffsets...)
+		reader.lazy.lineCount = lineCount
+		reader.Unlock()
+
+		select {
+		case reader.moreLinesAdded <- true:
+		default:
+		}
+
+		if eof {
+			break
+		}
+	}
+
+	t1 := time.Now().UnixNano()
+	dtNanos := t1 - t0
+	log.Debug("Indexed ", lineCount, " lines in ", dtNanos/1_000_000, "ms")
+}
+
+// Get a line, reading it from the file if it isn't cached
+func (lazy *lazyLines) getLine(lineNumberZeroBased int) *Line {
+	block := lazy.getBlock(lineNumberZeroBased / lazyIndexStride)
+	return block.lines[lineNumberZeroBased%lazyIndexStride]
+}
+
+func (lazy *lazyLines) getBlock(blockNumber int) *lazyBlock {
+	element, found := lazy.cache[blockNumber]
+	if found {
+		block := element.Value.(*lazyBlock)
+		if len(block.lines) == lazy.blockLineCount(blockNumber) {
+			lazy.cacheOrder.MoveToFront(element)
+			return block
+		}
+
+		// More lines have been indexed since we read this block
+		lazy.cacheOrder.Remove(element)
+		delete(lazy.cache, blockNumber)
+	}
+
+	block := lazy.readBlock(blockNumber)
+	lazy.cache[blockNumber] = lazy.cacheOrder.PushFront(block)
+
+	for lazy.cacheOrder.Len() > lazyCacheBlocks {
+		oldest := lazy.cacheOrder.Back()
+		lazy.cacheOrder.Remove(oldest)
+		delete(lazy.cache, oldest.Value.(*lazyBlock).number)
+	}
+
+	return block
+}
+
+// How many lines we currently know of in this block
+func (lazy *lazyLines) blockLineCount(blockNumber int) int {
+	lineCount := lazy.lineCount - blockNumber*lazyIndexStride
+	if lineCount > lazyIndexStride {
+		lineCount = lazyIndexStride
+	}
+	return lineCount
+}
+
+func (lazy *lazyLines) readBlock(blockNumber int) *lazyBlock {
+	if lazy.hexDump {
+		return lazy.readHexDumpBlock(blockNumber)
+	}
+
+	lineCount := lazy.blockLineCount(blockNumber)
+
+	start := lazy.offsets[blockNumber]
+	section := io.NewSectionReader(lazy.file, start, math.MaxInt64-start)
+	bufioReader := bufio.NewReader(section)
+
+	lines := make([]*Line, 0, lineCount)
+	completeLine := make([]byte, 0)
+	for len(lines) < lineCount {
+		lineBytes, err := bufioReader.ReadSlice('\n')
+		completeLine = append(completeLine, lineBytes...)
+		if err == bufio.ErrBufferFull {
+			// Line longer than our buffer, keep reading
+			continue
+		}
+
+		if err != nil && (err != io.EOF || len(completeLine) == 0) {
+			// The file must have changed since we indexed it
+			log.Warn("Failed to read line ", blockNumber*lazyIndexStride+len(lines)+1, ": ", err)
+			break
+		}
+
+		line := lineFromBytes(completeLine)
+		lines = append(lines, &line)
+		completeLine = completeLine[:0]
+	}
+
+	// Callers expect to get the number of lines they asked for
+	for len(lines) < lineCount {
+		line := NewLine("")
+		lines = append(lines, &line)
+	}
+
+	// Highlighting each block by itself means constructs spanning block
+	// borders (like long comments) may get the wrong colors. Highlighting
+	// everything up to here is what would fix that, but that's too slow.
+	if highlighted := highlightLines(lines, lazy.style, lazy.formatter, lazy.lexer); highlighted != nil {
+		lines = highlighted
+	}
+
+	return &lazyBlock{
+		number: blockNumber,
+		lines:  lines,
+	}
+}
+
+// Line n of a hex dump shows the bytes at offset n*hexDumpBytesPerLine
+func (lazy *lazyLines) readHexDumpBlock(blockNumber int) *lazyBlock {
+	lineCount := lazy.blockLineCount(blockNumber)
+
+	start := int64(blockNumber) * lazyIndexStride * hexDumpBytesPerLine
+	buffer := make([]byte, lineCount*hexDumpBytesPerLine)
+	byteCount, err := lazy.file.ReadAt(buffer, start)
+	if err != nil && err != io.EOF {
+		// The file must have changed since we opened it
+		log.Warn("Failed to read hex dump bytes at offset ", start, ": ", err)
+	}
+	buffer = buffer[:byteCount]
+
+	lines := make([]*Line, 0, lineCount)
+	for len(lines) < lineCount {
+		lineStart := len(lines) * hexDumpBytesPerLine
+		lineEnd := lineStart + hexDumpBytesPerLine
+		if lineStart > len(buffer) {
+			lineStart = len(buffer)
+		}
+		if lineEnd > len(buffer) {
+			lineEnd = len(buffer)
+		}
+
+		line := NewLine(formatHexDumpLine(start+int64(len(lines)*hexDumpBytesPerLine), buffer[lineStart:lineEnd]))
+		lines = append(lines, &line)
+	}
+
+	return &lazyBlock{
+		number: blockNumber,
+		lines:  lines,
+	}
+}
+
+// Nothing can be read after this
+func (lazy *lazyLines) close() {
+	if err := lazy.file.Close(); err != nil {
+		log.Debug("Failed to close lazily read file: ", err)
+	}
+}
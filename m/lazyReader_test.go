@@ -0,0 +1,175 @@
+package m
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"gotest.tools/v3/assert"
+)
+
+// Read all files lazily during this test
+func readEverythingLazily(t *testing.T) {
+	original := lazyReadingThreshold
+	lazyReadingThreshold = 0
+	t.Cleanup(func() {
+		lazyReadingThreshold = original
+	})
+}
+
+func openLazily(t *testing.T, contents string) *Reader {
+	readEverythingLazily(t)
+
+	filename := t.TempDir() + "/lazy.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte(contents), 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+	assert.Assert(t, reader.lazy != nil)
+
+	return reader
+}
+
+func TestLazyReader(t *testing.T) {
+	// Enough lines for a few blocks, plus a partial one
+	const lineCount = lazyIndexStride*3 + 17
+	builder := strings.Builder{}
+	for i := 1; i <= lineCount; i++ {
+		builder.WriteString(fmt.Sprintf("Line %d\n", i))
+	}
+	reader := openLazily(t, builder.String())
+
+	assert.Equal(t, reader.GetLineCount(), lineCount)
+	assert.Assert(t, reader.lines == nil)
+
+	assert.Equal(t, reader.GetLine(0), (*Line)(nil))
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "Line 1")
+	assert.Equal(t, reader.GetLine(lazyIndexStride).Plain(nil), fmt.Sprintf("Line %d", lazyIndexStride))
+	assert.Equal(t, reader.GetLine(lazyIndexStride+1).Plain(nil), fmt.Sprintf("Line %d", lazyIndexStride+1))
+	assert.Equal(t, reader.GetLine(lineCount).Plain(nil), fmt.Sprintf("Line %d", lineCount))
+	assert.Equal(t, reader.GetLine(lineCount+1), (*Line)(nil))
+
+	// Across a block boundary
+	lines, overflow := reader.GetLines(lazyIndexStride-1, 4)
+	assert.Equal(t, overflow, didOverflow)
+	assert.Equal(t, len(lines.lines), 4)
+	for i, line := range lines.lines {
+		assert.Equal(t, line.Plain(nil), fmt.Sprintf("Line %d", lazyIndexStride-1+i))
+	}
+	assert.Equal(t, lines.statusText, fmt.Sprintf("lazy.txt: %s lines  32%%", formatNumber(uint(lineCount))))
+
+	// Past the end, should give us the last lines
+	lines, _ = reader.GetLines(lineCount, 3)
+	assert.Equal(t, lines.firstLineOneBased, lineCount-2)
+	assert.Equal(t, lines.lines[2].Plain(nil), fmt.Sprintf("Line %d", lineCount))
+}
+
+func TestLazyReaderLineEndings(t *testing.T) {
+	reader := openLazily(t, "first\r\n\nthird")
+
+	assert.Equal(t, reader.GetLineCount(), 3)
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "first")
+	assert.Equal(t, reader.GetLine(2).Plain(nil), "")
+	assert.Equal(t, reader.GetLine(3).Plain(nil), "third")
+}
+
+func TestLazyReaderCacheIsBounded(t *testing.T) {
+	const lineCount = lazyIndexStride * (lazyCacheBlocks + 2)
+	reader := openLazily(t, strings.Repeat("x\n", lineCount))
+
+	for i := 1; i <= lineCount; i++ {
+		assert.Equal(t, reader.GetLine(i).Plain(nil), "x")
+	}
+
+	reader.Lock()
+	defer reader.Unlock()
+	assert.Equal(t, len(reader.lazy.cache), lazyCacheBlocks)
+	assert.Equal(t, reader.lazy.cacheOrder.Len(), lazyCacheBlocks)
+
+	// The first block should have been evicted, and the last one kept
+	_, found := reader.lazy.cache[0]
+	assert.Assert(t, !found)
+	_, found = reader.lazy.cache[lazyCacheBlocks+1]
+	assert.Assert(t, found)
+}
+
+func TestLazyReaderBinary(t *testing.T) {
+	reader := openLazily(t, "\x00\x01\x02")
+	assert.Assert(t, reader.binary.Load())
+}
+
+// Hex dumps of large files should be made on demand as well
+func TestLazyReaderHexDump(t *testing.T) {
+	contents := strings.Repeat("0123456789abcdef", lazyIndexStride+1) + "\x00\x01"
+	reader := openLazily(t, contents)
+
+	hexDump, created := reader.getHexDump()
+	assert.Assert(t, created)
+	assert.NilError(t, hexDump._wait())
+	assert.Assert(t, hexDump.lazy != nil)
+	assert.Equal(t, len(hexDump.lines), 0)
+	assert.Equal(t, hexDump.GetLineCount(), lazyIndexStride+2)
+
+	assert.Equal(t, hexDump.GetLine(1).Plain(nil),
+		"00000000  30 31 32 33 34 35 36 37  38 39 61 62 63 64 65 66  |0123456789abcdef|")
+	assert.Equal(t, hexDump.GetLine(lazyIndexStride+2).Plain(nil),
+		fmt.Sprintf("%08x  00 01                                             |..|", (lazyIndexStride+1)*hexDumpBytesPerLine))
+
+	lineNumber, err := hexDump.lineNumberAtByteOffset(hexDumpBytesPerLine*lazyIndexStride + 1)
+	assert.NilError(t, err)
+	assert.Equal(t, lineNumber, lazyIndexStride+1)
+
+	reader.stop()
+	_, err = hexDump.lazy.file.Stat()
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestLazyReaderHighlighting(t *testing.T) {
+	readEverythingLazily(t)
+
+	filename := t.TempDir() + "/lazy.go"
+	assert.NilError(t, os.WriteFile(filename, []byte("package main\n\n// A comment\n"), 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+	assert.Assert(t, reader.lazy != nil)
+
+	line := reader.GetLine(3)
+	assert.Assert(t, strings.Contains(line.raw, "\x1b["), line.raw)
+	assert.Equal(t, line.Plain(nil), "// A comment")
+}
+
+// Blocks read while indexing is still in progress must be read again when more
+// of their lines have been indexed
+func TestLazyReaderGrowingBlock(t *testing.T) {
+	filename := t.TempDir() + "/lazy.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte("one\ntwo\n"), 0o600))
+	file, err := os.Open(filename)
+	assert.NilError(t, err)
+	defer file.Close()
+
+	reader := newLazyReader(file, filename, *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, reader._wait())
+
+	// Pretend indexing was halfway done when we first read the block
+	reader.Lock()
+	defer reader.Unlock()
+	reader.lazy.lineCount = 1
+	assert.Equal(t, reader.lazy.getLine(0).Plain(nil), "one")
+
+	reader.lazy.lineCount = 2
+	assert.Equal(t, reader.lazy.getLine(1).Plain(nil), "two")
+}
+
+func TestLazyReaderStop(t *testing.T) {
+	reader := openLazily(t, "hej\n")
+
+	reader.stop()
+	_, err := reader.lazy.file.Stat()
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
@@ -0,0 +1,392 @@
+package m
+
+import (
+	"bufio"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	log "github.com/sirupsen/logrus"
+)
+
+// Input preprocessor support, compatible with LESSOPEN and LESSCLOSE. Ref:
+// https://man7.org/linux/man-pages/man1/less.1.html#INPUT_PREPROCESSOR
+//
+// LESSOPEN comes in two forms:
+//
+//   - "|command %s": Page the output of the command. If it produces no output,
+//     page the original file instead. With two leading pipes, "||command %s",
+//     no output means the file is empty if the command succeeded.
+//   - "command %s": The command prints the name of a replacement file to
+//     page. If it prints nothing, page the original file instead.
+//
+// In both cases %s is replaced by the name of the file to page.
+//
+// LESSCLOSE is run when we're done with the file. Its first %s is replaced by
+// the original file name, and its second %s by the name of the replacement
+// file. In the pipe form the replacement file name is "-".
+
+// If the preprocessor has nothing to say about this file, the returned Reader
+// shows the original file. Any problems with the preprocessor are reported
+// through the returned Reader either way.
+func newReaderFromLessOpen(filename string, style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer, options ReaderOptions) (*Reader, error) {
+	lessOpen := strings.TrimSpace(options.LessOpen)
+
+	var reader *Reader
+	var replacement string
+	var err error
+	if strings.HasPrefix(lessOpen, "|") {
+		reader, err = newReaderFromLessOpenPipe(filename, lessOpen, style, formatter, lexer, options)
+		replacement = "-"
+	} else {
+		reader, replacement, err = newReaderFromLessOpenFile(filename, lessOpen, style, formatter, lexer, options)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if options.LessClose != "" && replacement != "" {
+		reader.Lock()
+		reader.lessClose = expandLessCommand(options.LessClose, filename, replacement)
+		reader.Unlock()
+	}
+
+	return reader, nil
+}
+
+// How long to wait for a LESSOPEN pipe preprocessor to start talking before we
+// bring up the pager anyway. Waiting lets us page the original file the
+// usual way if the preprocessor has nothing to say, which is the common case.
+//
+// It's a variable so that the tests can change it.
+var lessOpenOutputTimeout = 200 * time.Millisecond
+
+func newReaderFromLessOpenPipe(filename string, lessOpen string, style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer, options ReaderOptions) (*Reader, error) {
+	emptyMeansEmpty := strings.HasPrefix(lessOpen, "||")
+
+	command := strings.TrimLeft(lessOpen, "|")
+
+	// "|-" means the preprocessor can handle stdin too, which we never ask
+	// it to do
+	command = strings.TrimPrefix(command, "-")
+
+	filter := exec.Command("sh", "-c", expandLessCommand(command, filename))
+	filterOut, filterErr, err := startFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &_LessOpenOutput{
+		filename:        filename,
+		filter:          filter,
+		filterErr:       filterErr,
+		emptyMeansEmpty: emptyMeansEmpty,
+		style:           style,
+		formatter:       formatter,
+		lexer:           lexer,
+		options:         options,
+		buffered:        bufio.NewReader(filterOut),
+		peeked:          make(chan error, 1),
+	}
+	go func() {
+		_, err := output.buffered.Peek(1)
+		output.peeked <- err
+	}()
+
+	// The preprocessor output has no file name to guess the language from,
+	// but the original file does
+	if lexer == nil {
+		lexer = lexers.Match(filename)
+	}
+
+	select {
+	case err = <-output.peeked:
+		output.peeked <- err // For output.Read() to find
+	case <-time.After(lessOpenOutputTimeout):
+		// Slow preprocessor, don't keep the user waiting. If it turns out
+		// to have no output, output.Read() will handle that.
+		log.Debug("LESSOPEN preprocessor is slow, not waiting for it")
+		reader := newReaderFromFilter(filename, filter, output, filterErr, style, formatter, lexer)
+		reader.Lock()
+		reader.lessOpenOutput = output
+		reader.Unlock()
+		return reader, nil
+	}
+
+	if err == nil {
+		// We got some output, page it
+		return newReaderFromFilter(filename, filter, output, filterErr, style, formatter, lexer), nil
+	}
+
+	stderrText, err, pageOriginal := output.finish(err)
+	if !pageOriginal {
+		reader := NewReaderFromText(filename, "")
+		reader.setFilterResult(stderrText, err)
+		return reader, nil
+	}
+	return openOriginal(filename, style, formatter, lexer, options, stderrText, err)
+}
+
+// Output from a LESSOPEN pipe preprocessor. If the preprocessor turns out to
+// have no output, Read() will set up a Reader for the original file, and then
+// return EOF. The pager will then switch to that Reader, see replacement().
+type _LessOpenOutput struct {
+	filename        string
+	filter          *exec.Cmd
+	filterErr       *_FilterStderr
+	emptyMeansEmpty bool
+
+	// For opening the original file
+	style     chroma.Style
+	formatter chroma.Formatter
+	lexer     chroma.Lexer
+	options   ReaderOptions
+
+	buffered *bufio.Reader
+
+	// Gets the result of peeking at the first byte of output
+	peeked chan error
+
+	// What we're returning from Read(), nil until we know
+	source io.Reader
+
+	// The original file, if the preprocessor had nothing to say about it.
+	// Set by Read() before it returns EOF.
+	original *Reader
+}
+
+func (output *_LessOpenOutput) Read(p []byte) (int, error) {
+	if output.source != nil {
+		return output.source.Read(p)
+	}
+
+	err := <-output.peeked
+	if err == nil {
+		output.source = output.buffered
+		return output.source.Read(p)
+	}
+
+	// Nothing to show from the preprocessor
+	output.source = strings.NewReader("")
+
+	stderrText, err, pageOriginal := output.finish(err)
+	if !pageOriginal {
+		if stderrText != "" {
+			log.Warn("LESSOPEN preprocessor stderr: ", stderrText)
+		}
+		return 0, io.EOF
+	}
+
+	original, err := openOriginal(output.filename, output.style, output.formatter, output.lexer, output.options, stderrText, err)
+	if err != nil {
+		return 0, err
+	}
+	output.original = original
+	return 0, io.EOF
+}
+
+// Call this if the preprocessor produced no output. Waits for it to exit, and
+// returns what it said on stderr, how it exited and whether the original file
+// should be paged instead.
+func (output *_LessOpenOutput) finish(peekErr error) (string, error, bool) {
+	if peekErr != io.EOF {
+		log.Warn("Reading from LESSOPEN preprocessor failed: ", peekErr)
+	}
+
+	stderrText, err := waitForFilter(output.filter, output.filterErr)
+	log.Debug("LESSOPEN preprocessor produced no output, exit status: ", err)
+
+	return stderrText, err, !output.emptyMeansEmpty || err != nil
+}
+
+// If this Reader shows the output of a LESSOPEN preprocessor that had nothing
+// to say, this returns a Reader for the original file. The pager should show
+// that one instead.
+func (reader *Reader) replacement() *Reader {
+	if !reader.done.Load() {
+		// Not done reading the preprocessor output, so we don't know yet
+		return nil
+	}
+
+	reader.Lock()
+	defer reader.Unlock()
+	if reader.lessOpenOutput == nil {
+		return nil
+	}
+	return reader.lessOpenOutput.original
+}
+
+// Open the original file, without any preprocessing. Whatever went wrong with
+// the preprocessor is reported through the returned Reader, see errors.go.
+func openOriginal(filename string, style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer, options ReaderOptions, stderrText string, filterErr error) (*Reader, error) {
+	options.LessOpen = ""
+	options.LessClose = ""
+	reader, err := NewReaderFromFilenameWithOptions(filename, style, formatter, lexer, options)
+	if err != nil {
+		return nil, err
+	}
+
+	reader.setFilterResult(stderrText, filterErr)
+	return reader, nil
+}
+
+// Returns the reader and the name of the replacement file
+func newReaderFromLessOpenFile(filename string, lessOpen string, style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer, options ReaderOptions) (*Reader, string, error) {
+	filter := exec.Command("sh", "-c", expandLessCommand(lessOpen, filename))
+	filterOut, filterErr, err := startFilter(filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	output, readErr := io.ReadAll(filterOut)
+	stderrText, err := waitForFilter(filter, filterErr)
+	if err == nil && readErr != nil {
+		err = readErr
+	}
+
+	replacement := strings.TrimSpace(string(output))
+	if err != nil || replacement == "" {
+		if err != nil {
+			log.Warnf("LESSOPEN preprocessor failed on %s: %s", filename, err)
+		} else {
+			log.Debug("LESSOPEN preprocessor had no replacement for ", filename)
+		}
+
+		reader, err := openOriginal(filename, style, formatter, lexer, options, stderrText, err)
+		return reader, "", err
+	}
+
+	// The replacement file is a snapshot made by the preprocessor, there is
+	// nothing to follow and nothing more to preprocess
+	options.Follow = false
+	options.LessOpen = ""
+	options.LessClose = ""
+	reader, err := NewReaderFromFilenameWithOptions(replacement, style, formatter, lexer, options)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Show the name the user asked for, not the temp file name
+	reader.Lock()
+	reader.name = &filename
+	reader.filterStderr = stderrText
+	reader.Unlock()
+
+	return reader, replacement, nil
+}
+
+// Replace the %s placeholders in a LESSOPEN or LESSCLOSE command with the given
+// file names, in order.
+//
+// Placeholders can be written either bare or within quotes, like '%s' or "%s".
+// Either way the file name ends up as one shell word.
+func expandLessCommand(command string, filenames ...string) string {
+	searchFrom := 0
+	for _, filename := range filenames {
+		index := strings.Index(command[searchFrom:], "%s")
+		if index < 0 {
+			break
+		}
+		index += searchFrom
+
+		var expanded string
+		switch shellQuoteAt(command[:index]) {
+		case '\'':
+			expanded = strings.ReplaceAll(filename, "'", `'\''`)
+		case '"':
+			expanded = doubleQuoteEscaper.Replace(filename)
+		default:
+			expanded = shellQuote(filename)
+		}
+
+		command = command[:index] + expanded + command[index+len("%s"):]
+		searchFrom = index + len(expanded)
+	}
+	return command
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Characters that are special within double quotes in sh
+var doubleQuoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+
+// Given the beginning of a shell command, return the kind of quote (' or ")
+// we're inside of at its end. Returns 0 if we aren't inside of any quotes.
+func shellQuoteAt(commandStart string) rune {
+	var quote rune
+	escaped := false
+	for _, char := range commandStart {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '\'':
+			if char == '\'' {
+				quote = 0
+			}
+		case char == '\\':
+			escaped = true
+		case quote == '"':
+			if char == '"' {
+				quote = 0
+			}
+		case char == '\'' || char == '"':
+			quote = char
+		}
+	}
+	return quote
+}
+
+// Run the LESSCLOSE command for this reader, if any. Call this when we're done
+// with the reader.
+//
+// Calling this more than once is fine, the command will only run once.
+func (reader *Reader) runLessClose() {
+	reader.Lock()
+	lessClose := reader.lessClose
+	reader.Unlock()
+
+	if lessClose == "" {
+		return
+	}
+
+	reader.lessCloseOnce.Do(func() {
+		output, err := exec.Command("sh", "-c", lessClose).CombinedOutput()
+		if err != nil {
+			log.Warnf("LESSCLOSE command failed: %s: %s", strings.TrimSpace(string(output)), err)
+		}
+	})
+}
+
+// Switch from slow LESSOPEN preprocessors that had nothing to say to their
+// original files, see Reader.replacement().
+func (p *Pager) maybeUseReplacements() {
+	for _, reader := range p.openReaders() {
+		original := reader.replacement()
+		if original == nil {
+			continue
+		}
+		log.Debug("LESSOPEN preprocessor had no output, paging the original file")
+
+		// Reloading and going back should work like for the preprocessed
+		// Reader
+		reader.Lock()
+		reader.lessOpenOutput = nil
+		reopen := reader.reopen
+		openedFrom := reader.openedFrom
+		reader.Unlock()
+		original.Lock()
+		original.reopen = reopen
+		original.openedFrom = openedFrom
+		original.Unlock()
+
+		p.own(original)
+		p.watchReader(original)
+		p.replaceReader(reader, original)
+	}
+}
@@ -0,0 +1,184 @@
+package m
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"gotest.tools/v3/assert"
+)
+
+// Create a file containing "hej"
+func writeHejFile(t *testing.T) string {
+	filename := t.TempDir() + "/hej.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte("hej\n"), 0o600))
+	return filename
+}
+
+func readWithLessOpen(t *testing.T, filename string, options ReaderOptions) *Reader {
+	reader, err := NewReaderFromFilenameWithOptions(filename, *styles.Get("native"), formatters.TTY16m, nil, options)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+	return reader
+}
+
+// Like readWithLessOpen(), but the preprocessor is expected to fail
+func readWithFailingLessOpen(t *testing.T, filename string, options ReaderOptions, expectedError string) *Reader {
+	reader, err := NewReaderFromFilenameWithOptions(filename, *styles.Get("native"), formatters.TTY16m, nil, options)
+	assert.NilError(t, err)
+	assert.ErrorContains(t, reader._wait(), expectedError)
+	return reader
+}
+
+func TestLessOpenPipe(t *testing.T) {
+	hejFile := writeHejFile(t)
+	reader := readWithLessOpen(t, hejFile, ReaderOptions{LessOpen: "|tr a-z A-Z < %s"})
+
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "HEJ")
+	assert.Equal(t, *reader.name, hejFile)
+}
+
+func TestLessOpenPipeNoOutput(t *testing.T) {
+	hejFile := writeHejFile(t)
+
+	// No output means we should show the original file
+	reader := readWithLessOpen(t, hejFile, ReaderOptions{LessOpen: "|true %s"})
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "hej")
+
+	// Unless we have two pipes and the preprocessor succeeded
+	reader = readWithLessOpen(t, hejFile, ReaderOptions{LessOpen: "||true %s"})
+	assert.Equal(t, reader.GetLineCount(), 0)
+
+	// A failing preprocessor still means the original file
+	reader = readWithFailingLessOpen(t, hejFile, ReaderOptions{LessOpen: "||false %s"}, "exit status 1")
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "hej")
+}
+
+// Slow preprocessors shouldn't delay startup, but should still work the same
+func TestLessOpenPipeSlow(t *testing.T) {
+	defer func(timeout time.Duration) { lessOpenOutputTimeout = timeout }(lessOpenOutputTimeout)
+	lessOpenOutputTimeout = 0
+
+	hejFile := writeHejFile(t)
+	reader := readWithLessOpen(t, hejFile, ReaderOptions{LessOpen: "|sleep 0.1; tr a-z A-Z < %s"})
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "HEJ")
+
+	// No output means the pager should switch to the original file
+	reader = readWithLessOpen(t, hejFile, ReaderOptions{LessOpen: "|sleep 0.1 #%s"})
+	assert.Equal(t, reader.GetLineCount(), 0)
+	original := reader.replacement()
+	assert.Assert(t, original != nil)
+	assert.NilError(t, original._wait())
+	assert.Equal(t, original.GetLine(1).Plain(nil), "hej")
+
+	reader = readWithLessOpen(t, hejFile, ReaderOptions{LessOpen: "||sleep 0.1 #%s"})
+	assert.Equal(t, reader.GetLineCount(), 0)
+	assert.Assert(t, reader.replacement() == nil)
+}
+
+func TestLessOpenPipeSlowPager(t *testing.T) {
+	defer func(timeout time.Duration) { lessOpenOutputTimeout = timeout }(lessOpenOutputTimeout)
+	lessOpenOutputTimeout = 0
+
+	reader := readWithLessOpen(t, writeHejFile(t), ReaderOptions{LessOpen: "|sleep 0.1 #%s"})
+	original := reader.replacement()
+	assert.Assert(t, original != nil)
+	pager := newGotoTestPager(t, reader)
+
+	pager.maybeUseReplacements()
+	assert.Equal(t, pager.reader, LineSource(original))
+	assert.Assert(t, original.reopen != nil, "Reloading should still work")
+	assert.NilError(t, original._wait())
+}
+
+func TestLessOpenPipeFailure(t *testing.T) {
+	reader, err := NewReaderFromFilenameWithOptions(
+		writeHejFile(t), *styles.Get("native"), formatters.TTY16m, nil,
+		ReaderOptions{LessOpen: "|echo partial; echo oops >&2; exit 3 #%s"})
+	assert.NilError(t, err)
+
+	// Errors are reported just like for other filters
+	assert.ErrorContains(t, reader._wait(), "oops")
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "partial")
+}
+
+// When the original file is paged, it should be paged just like without
+// LESSOPEN, and we should still hear about any preprocessor problems
+func TestLessOpenPipeOriginal(t *testing.T) {
+	reader := readWithLessOpen(t, getSamplesDir()+"/compressed.txt.gz", ReaderOptions{LessOpen: "|echo oops >&2 #%s"})
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "This is a compressed file")
+	assert.Equal(t, reader.filterStderr, "oops")
+
+	reader = readWithFailingLessOpen(t, "lessopen.go", ReaderOptions{LessOpen: "|exit 3 #%s"}, "exit status 3")
+	waitForHighlighting(t, reader, 1)
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "package m")
+}
+
+// Preprocessor output should be highlighted like the original file would have
+// been
+func TestLessOpenPipeHighlighting(t *testing.T) {
+	reader := readWithLessOpen(t, "lessopen.go", ReaderOptions{LessOpen: "|cat %s"})
+	waitForHighlighting(t, reader, 1)
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "package m")
+}
+
+func TestLessOpenFileFailure(t *testing.T) {
+	hejFile := writeHejFile(t)
+
+	// Failures should be reported, and we should get the original file
+	reader := readWithFailingLessOpen(t, hejFile, ReaderOptions{LessOpen: "echo oops >&2; exit 3 #%s"}, "oops: exit status 3")
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "hej")
+	assert.Equal(t, reader.filterStderr, "oops")
+
+	// No replacement file means the original file
+	reader = readWithLessOpen(t, hejFile, ReaderOptions{LessOpen: "true %s"})
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "hej")
+	assert.NilError(t, reader.Err())
+}
+
+func TestLessOpenReplacementFile(t *testing.T) {
+	hejFile := writeHejFile(t)
+	tempDir := t.TempDir()
+	replacement := tempDir + "/replacement.txt"
+	assert.NilError(t, os.WriteFile(replacement, []byte("replaced\n"), 0o600))
+
+	reader := readWithLessOpen(t, hejFile, ReaderOptions{
+		LessOpen:  "echo " + shellQuote(replacement) + " #%s",
+		LessClose: "echo %s %s > " + shellQuote(tempDir+"/closed.txt"),
+	})
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "replaced")
+	assert.Equal(t, *reader.name, hejFile)
+
+	reader.runLessClose()
+	closed, err := os.ReadFile(tempDir + "/closed.txt")
+	assert.NilError(t, err)
+	assert.Equal(t, string(closed), hejFile+" "+replacement+"\n")
+}
+
+func TestExpandLessCommand(t *testing.T) {
+	assert.Equal(t,
+		expandLessCommand("lessclose %s %s", "it's.txt", "-"),
+		`lessclose 'it'\''s.txt' '-'`)
+
+	// Already quoted placeholders should be left quoted, just like in less
+	assert.Equal(t,
+		expandLessCommand(`lessclose '%s' "%s"`, "it's.txt", `"$x".txt`),
+		`lessclose 'it'\''s.txt' "\"\$x\".txt"`)
+
+	// Placeholders in file names should be left alone
+	assert.Equal(t,
+		expandLessCommand("lessclose %s %s", "%s.txt", "-"),
+		`lessclose '%s.txt' '-'`)
+}
+
+func TestShellQuoteAt(t *testing.T) {
+	assert.Equal(t, shellQuoteAt(`echo `), rune(0))
+	assert.Equal(t, shellQuoteAt(`echo '`), '\'')
+	assert.Equal(t, shellQuoteAt(`echo "`), '"')
+	assert.Equal(t, shellQuoteAt(`echo "'`), '"')
+	assert.Equal(t, shellQuoteAt(`echo \"`), rune(0))
+	assert.Equal(t, shellQuoteAt(`echo '\'`), rune(0))
+	assert.Equal(t, shellQuoteAt(`echo "\"`), '"')
+}
@@ -0,0 +1,149 @@
+package m
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/walles/moar/twin"
+)
+
+// A single line of text with a movable cursor, used by the search and goto
+// prompts.
+type _LineEditor struct {
+	text string
+
+	// Counted in runes, 0 is before the first rune, and the text length is
+	// after the last one.
+	cursor int
+}
+
+// Replace the text, with the cursor at the end
+func (editor *_LineEditor) setText(text string) {
+	editor.text = text
+	editor.cursor = len([]rune(text))
+}
+
+func (editor *_LineEditor) insert(text string) {
+	runes := []rune(editor.text)
+	inserted := []rune(text)
+
+	newRunes := make([]rune, 0, len(runes)+len(inserted))
+	newRunes = append(newRunes, runes[:editor.cursor]...)
+	newRunes = append(newRunes, inserted...)
+	newRunes = append(newRunes, runes[editor.cursor:]...)
+
+	editor.text = string(newRunes)
+	editor.cursor += len(inserted)
+}
+
+// Remove the runes between from and to, and put the cursor where they were
+func (editor *_LineEditor) remove(from int, to int) {
+	runes := []rune(editor.text)
+	editor.text = string(runes[:from]) + string(runes[to:])
+	editor.cursor = from
+}
+
+// CTRL-w, remove the word before the cursor, plus any whitespace after it
+func (editor *_LineEditor) removeWord() {
+	runes := []rune(editor.text)
+
+	start := editor.cursor
+	for start > 0 && unicode.IsSpace(runes[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(runes[start-1]) {
+		start--
+	}
+
+	editor.remove(start, editor.cursor)
+}
+
+// Insert pasted text. Line breaks make no sense in a single line prompt, so
+// trailing ones are dropped and the rest become spaces.
+func (editor *_LineEditor) paste(text string) {
+	text = strings.TrimRight(text, "\r\n")
+	text = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(text)
+	editor.insert(text)
+}
+
+// Returns true if the key was an editing key
+func (editor *_LineEditor) onKey(key twin.KeyCode) bool {
+	length := len([]rune(editor.text))
+
+	switch key {
+	case twin.KeyLeft:
+		if editor.cursor > 0 {
+			editor.cursor--
+		}
+
+	case twin.KeyRight:
+		if editor.cursor < length {
+			editor.cursor++
+		}
+
+	case twin.KeyHome:
+		editor.cursor = 0
+
+	case twin.KeyEnd:
+		editor.cursor = length
+
+	case twin.KeyBackspace:
+		if editor.cursor > 0 {
+			editor.remove(editor.cursor-1, editor.cursor)
+		}
+
+	case twin.KeyDelete:
+		if editor.cursor < length {
+			editor.remove(editor.cursor, editor.cursor+1)
+		}
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+// Handle editing control characters, and insert anything else
+func (editor *_LineEditor) onRune(char rune) {
+	switch char {
+	case '\x17': // CTRL-w
+		editor.removeWord()
+
+	case '\x15': // CTRL-u
+		editor.setText("")
+
+	default:
+		editor.insert(string(char))
+	}
+}
+
+// Draw the text starting at column, with the cursor shown in reverse video.
+// If the text doesn't fit, it's scrolled sideways to keep the cursor visible.
+//
+// Returns the first column after what we drew.
+func (editor *_LineEditor) render(screen twin.Screen, column int, row int) int {
+	width, _ := screen.Size()
+	runes := []rune(editor.text)
+
+	firstVisible := 0
+	if column+editor.cursor >= width {
+		firstVisible = column + editor.cursor - width + 1
+	}
+
+	for i := firstVisible; i < len(runes); i++ {
+		style := twin.StyleDefault
+		if i == editor.cursor {
+			style = style.WithAttr(twin.AttrReverse)
+		}
+		screen.SetCell(column, row, twin.NewCell(runes[i], style))
+		column++
+	}
+
+	if editor.cursor == len(runes) {
+		screen.SetCell(column, row, twin.NewCell(' ', twin.StyleDefault.WithAttr(twin.AttrReverse)))
+		column++
+	}
+
+	return column
+}
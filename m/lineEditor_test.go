@@ -0,0 +1,139 @@
+package m
+
+import (
+	"testing"
+
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func TestLineEditorCursorMovement(t *testing.T) {
+	editor := _LineEditor{}
+	editor.setText("abc")
+	assert.Equal(t, editor.cursor, 3)
+
+	editor.onKey(twin.KeyLeft)
+	editor.onRune('x')
+	assert.Equal(t, editor.text, "abxc")
+
+	editor.onKey(twin.KeyHome)
+	editor.onKey(twin.KeyLeft)
+	editor.onRune('y')
+	assert.Equal(t, editor.text, "yabxc")
+
+	editor.onKey(twin.KeyEnd)
+	editor.onKey(twin.KeyRight)
+	editor.onRune('z')
+	assert.Equal(t, editor.text, "yabxcz")
+}
+
+func TestLineEditorDelete(t *testing.T) {
+	editor := _LineEditor{}
+	editor.setText("åäö")
+
+	editor.onKey(twin.KeyHome)
+	editor.onKey(twin.KeyBackspace)
+	assert.Equal(t, editor.text, "åäö")
+	editor.onKey(twin.KeyDelete)
+	assert.Equal(t, editor.text, "äö")
+
+	editor.onKey(twin.KeyEnd)
+	editor.onKey(twin.KeyDelete)
+	assert.Equal(t, editor.text, "äö")
+	editor.onKey(twin.KeyBackspace)
+	assert.Equal(t, editor.text, "ä")
+	assert.Equal(t, editor.cursor, 1)
+}
+
+func TestLineEditorRemoveWord(t *testing.T) {
+	editor := _LineEditor{}
+	editor.setText("one two  three")
+
+	// Cursor after "two  "
+	for i := 0; i < 5; i++ {
+		editor.onKey(twin.KeyLeft)
+	}
+	editor.onRune('\x17')
+	assert.Equal(t, editor.text, "one three")
+	assert.Equal(t, editor.cursor, 4)
+
+	editor.onRune('\x17')
+	assert.Equal(t, editor.text, "three")
+
+	editor.onRune('\x17')
+	assert.Equal(t, editor.text, "three")
+
+	editor.onRune('\x15')
+	assert.Equal(t, editor.text, "")
+	assert.Equal(t, editor.cursor, 0)
+}
+
+func TestLineEditorPaste(t *testing.T) {
+	editor := _LineEditor{}
+	editor.setText("ac")
+	editor.onKey(twin.KeyLeft)
+
+	editor.paste("b1\nb2\r\n")
+	assert.Equal(t, editor.text, "ab1 b2c")
+	assert.Equal(t, editor.cursor, 6)
+}
+
+func TestLineEditorRender(t *testing.T) {
+	screen := twin.NewFakeScreen(10, 1)
+	screen.Clear()
+	editor := _LineEditor{}
+	editor.setText("abc")
+	editor.onKey(twin.KeyLeft)
+
+	assert.Equal(t, editor.render(screen, 2, 0), 5)
+	assert.Equal(t, rowToString(screen.GetRow(0)), "  abc")
+	assert.Equal(t, screen.GetRow(0)[4].Style, twin.StyleDefault.WithAttr(twin.AttrReverse))
+
+	// Too long, should be scrolled to show the cursor at the right edge
+	screen.Clear()
+	editor.setText("0123456789")
+	assert.Equal(t, editor.render(screen, 2, 0), 10)
+	assert.Equal(t, rowToString(screen.GetRow(0)), "  3456789")
+}
+
+// Fixing a typo in the middle of a search should update the search
+func TestSearchPromptEditing(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+
+	typeRunes(pager, "/Lxne 42")
+	for i := 0; i < 5; i++ {
+		pager.onKey(twin.KeyLeft)
+	}
+	pager.onKey(twin.KeyBackspace)
+	typeRunes(pager, "i")
+	assert.Equal(t, pager.searchEditor.text, "Line 42")
+	assert.Equal(t, pager.searchPattern.String(), "Line 42")
+
+	pager.redraw("")
+	screen := pager.screen.(*twin.FakeScreen)
+	assert.Equal(t, rowToString(screen.GetRow(9)), "Search: Line 42")
+	assert.Equal(t, screen.GetRow(9)[10].Style, twin.StyleDefault.WithAttr(twin.AttrReverse))
+
+	pager.onKey(twin.KeyEnter)
+	assert.Equal(t, pager.lineNumberOneBased(), 42)
+}
+
+func TestGotoPromptEditing(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+
+	typeRunes(pager, "g5")
+	pager.onKey(twin.KeyHome)
+	pager.onPaste("1")
+	pager.onKey(twin.KeyEnter)
+	assert.Equal(t, pager.mode, _Viewing)
+	assert.Equal(t, pager.lineNumberOneBased(), 15)
+}
+
+// Pasting into the pager shouldn't run the pasted text as commands
+func TestPasteWhileViewing(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+
+	pager.onPaste("q")
+	assert.Equal(t, pager.quit, false)
+	assert.Equal(t, pager.mode, _Viewing)
+}
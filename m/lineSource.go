@@ -0,0 +1,88 @@
+package m
+
+// LineSource is what the pager shows lines from. *Reader is the default
+// implementation, implement this yourself to page through lines from somewhere
+// else, like a database cursor or an in-memory buffer.
+//
+// The pager calls these methods from its own goroutine, so implementations
+// must be safe for concurrent use if lines are added from elsewhere.
+type LineSource interface {
+	// GetLineCount returns the number of lines available right now
+	GetLineCount() int
+
+	// GetLine returns nil if the line number is out of bounds
+	GetLine(lineNumberOneBased int) *Line
+
+	// GetLineRange returns up to wantedLineCount lines starting at
+	// firstLineOneBased, plus the text to show in the status bar.
+	//
+	// If there aren't enough lines after firstLineOneBased, return the last
+	// wantedLineCount lines instead. That's how the pager finds out it has
+	// scrolled too far.
+	GetLineRange(firstLineOneBased int, wantedLineCount int) *LineRange
+
+	// Done returns true when no more lines will be added
+	Done() bool
+
+	// MoreLinesAdded receives a value when lines have been added or changed.
+	// Send to it without blocking, a buffer size of one is enough.
+	MoreLinesAdded() <-chan bool
+
+	// MaybeDone receives a value when Done() may have started returning true.
+	// Send to it without blocking, a buffer size of one is enough.
+	MaybeDone() <-chan bool
+}
+
+// LineRange contains a number of lines from a LineSource, plus metadata
+type LineRange struct {
+	Lines []*Line
+
+	// One-based line number of the first line returned
+	FirstLineOneBased int
+
+	// "monkey.txt: 1-23/45 51%"
+	StatusText string
+}
+
+// MoreLinesAdded is part of the LineSource interface
+func (reader *Reader) MoreLinesAdded() <-chan bool {
+	return reader.moreLinesAdded
+}
+
+// MaybeDone is part of the LineSource interface
+func (reader *Reader) MaybeDone() <-chan bool {
+	return reader.maybeDone
+}
+
+// Identifies a LineSource. LineSources that aren't ours may not be comparable,
+// so we can't compare them or use them as map keys. Those are only ever shown
+// as files though, so we know them by their index in the files list.
+type _SourceID struct {
+	reader    *Reader
+	fileIndex int
+}
+
+// The ID of a LineSource, which must be either one of our own Readers or the
+// file at fileIndex
+func sourceID(source LineSource, fileIndex int) _SourceID {
+	if reader := asReader(source); reader != nil {
+		return _SourceID{reader: reader, fileIndex: -1}
+	}
+	return _SourceID{fileIndex: fileIndex}
+}
+
+// The ID of whatever we're showing right now
+func (p *Pager) currentSourceID() _SourceID {
+	return sourceID(p.reader, p.currentFileIndex)
+}
+
+// If we're showing a Reader, return it. Returns nil for other LineSources.
+func asReader(source LineSource) *Reader {
+	switch reader := source.(type) {
+	case *Reader:
+		return reader
+	case *AppendableReader:
+		return reader.Reader
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package m
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+// Keeps the last few lines added to it, like an event log would
+type ringBuffer struct {
+	sync.Mutex
+	lines   []*Line
+	dropped int
+	maxSize int
+
+	moreLinesAdded chan bool
+	maybeDone      chan bool
+}
+
+func newRingBuffer(maxSize int) *ringBuffer {
+	return &ringBuffer{
+		maxSize:        maxSize,
+		moreLinesAdded: make(chan bool, 1),
+		maybeDone:      make(chan bool, 1),
+	}
+}
+
+func (ring *ringBuffer) add(text string) {
+	line := NewLine(text)
+
+	ring.Lock()
+	ring.lines = append(ring.lines, &line)
+	if len(ring.lines) > ring.maxSize {
+		ring.lines = ring.lines[1:]
+		ring.dropped++
+	}
+	ring.Unlock()
+
+	select {
+	case ring.moreLinesAdded <- true:
+	default:
+	}
+}
+
+func (ring *ringBuffer) GetLineCount() int {
+	ring.Lock()
+	defer ring.Unlock()
+	return len(ring.lines)
+}
+
+func (ring *ringBuffer) GetLine(lineNumberOneBased int) *Line {
+	ring.Lock()
+	defer ring.Unlock()
+	if lineNumberOneBased < 1 || lineNumberOneBased > len(ring.lines) {
+		return nil
+	}
+	return ring.lines[lineNumberOneBased-1]
+}
+
+func (ring *ringBuffer) GetLineRange(firstLineOneBased int, wantedLineCount int) *LineRange {
+	ring.Lock()
+	defer ring.Unlock()
+
+	if firstLineOneBased+wantedLineCount-1 > len(ring.lines) {
+		firstLineOneBased = len(ring.lines) - wantedLineCount + 1
+	}
+	if firstLineOneBased < 1 {
+		firstLineOneBased = 1
+	}
+	last := firstLineOneBased + wantedLineCount - 1
+	if last > len(ring.lines) {
+		last = len(ring.lines)
+	}
+
+	return &LineRange{
+		Lines:             ring.lines[firstLineOneBased-1 : last],
+		FirstLineOneBased: firstLineOneBased,
+		StatusText:        fmt.Sprintf("events: %d dropped", ring.dropped),
+	}
+}
+
+func (ring *ringBuffer) Done() bool {
+	return false
+}
+
+func (ring *ringBuffer) MoreLinesAdded() <-chan bool {
+	return ring.moreLinesAdded
+}
+
+func (ring *ringBuffer) MaybeDone() <-chan bool {
+	return ring.maybeDone
+}
+
+func TestPageLineSource(t *testing.T) {
+	ring := newRingBuffer(5)
+	for i := 1; i <= 7; i++ {
+		ring.add(fmt.Sprintf("Event %d", i))
+	}
+
+	screen := twin.NewFakeScreen(20, 4)
+	pager := NewPager(ring)
+	pager.ShowLineNumbers = false
+	pager.Quit()
+	pager.StartPaging(screen, nil, nil)
+
+	pager.scrollToEnd()
+	pager.redraw("")
+	assert.Equal(t, rowToString(screen.GetRow(0)), "Event 5")
+	assert.Equal(t, rowToString(screen.GetRow(2)), "Event 7")
+	assert.Equal(t, rowToString(screen.GetRow(3))[:20], "events: 2 dropped  P")
+
+	// Search from the top
+	pager.scrollPosition = newScrollPosition("TestPageLineSource")
+	pager.searchPattern = toPattern("Event 7")
+	pager.scrollToNextSearchHit()
+	assert.Equal(t, pager.mode, _Viewing)
+	pager.redraw("")
+	assert.Equal(t, rowToString(screen.GetRow(2)), "Event 7")
+}
+
+// Reader specific features should just not do anything for other LineSources
+func TestLineSourceReaderFeatures(t *testing.T) {
+	ring := newRingBuffer(5)
+	ring.add("Event")
+
+	pager := NewPager(ring)
+	pager.screen = twin.NewFakeScreen(20, 4)
+
+	pager.toggleHexView()
+	pager.backToListing()
+	assert.Equal(t, pager.reader, LineSource(ring))
+
+	pager.reload()
+	assert.Equal(t, pager.getStatusMessage(), "Only files and commands can be reloaded")
+
+	pager.showProblems()
+	assert.Equal(t, pager.getStatusMessage(), "No problems reading this input")
+	assert.Equal(t, pager.reader, LineSource(ring))
+}
+
+// A LineSource that can't be compared, since it contains a slice and isn't a
+// pointer
+type fixedLines struct {
+	lines     []*Line
+	maybeDone chan bool
+}
+
+func newFixedLines(count int) fixedLines {
+	lines := fixedLines{maybeDone: make(chan bool, 1)}
+	for i := 1; i <= count; i++ {
+		line := NewLine(fmt.Sprintf("Line %d", i))
+		lines.lines = append(lines.lines, &line)
+	}
+	return lines
+}
+
+func (fixed fixedLines) GetLineCount() int {
+	return len(fixed.lines)
+}
+
+func (fixed fixedLines) GetLine(lineNumberOneBased int) *Line {
+	if lineNumberOneBased < 1 || lineNumberOneBased > len(fixed.lines) {
+		return nil
+	}
+	return fixed.lines[lineNumberOneBased-1]
+}
+
+func (fixed fixedLines) GetLineRange(firstLineOneBased int, wantedLineCount int) *LineRange {
+	last := firstLineOneBased + wantedLineCount - 1
+	if last > len(fixed.lines) {
+		last = len(fixed.lines)
+	}
+	return &LineRange{
+		Lines:             fixed.lines[firstLineOneBased-1 : last],
+		FirstLineOneBased: firstLineOneBased,
+		StatusText:        "fixed",
+	}
+}
+
+func (fixed fixedLines) Done() bool {
+	return true
+}
+
+func (fixed fixedLines) MoreLinesAdded() <-chan bool {
+	return nil
+}
+
+func (fixed fixedLines) MaybeDone() <-chan bool {
+	return fixed.maybeDone
+}
+
+func TestUncomparableLineSources(t *testing.T) {
+	screen := twin.NewFakeScreen(20, 10)
+	pager := newPagerFromSources([]LineSource{newFixedLines(100), newFixedLines(100)})
+	pager.Quit()
+	pager.StartPaging(screen, nil, nil)
+
+	gotoLine(pager, "30")
+	typeRunes(pager, "mA")
+	typeRunes(pager, ":n")
+	assert.Equal(t, pager.currentFileIndex, 1)
+
+	pager.searchPattern = toPattern("Line 50")
+	pager.scrollToNextSearchHit()
+	typeRunes(pager, "'A")
+	assert.Equal(t, pager.currentFileIndex, 0)
+	assert.Equal(t, pager.lineNumberOneBased(), 30)
+}
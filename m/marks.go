@@ -0,0 +1,218 @@
+package m
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/walles/moar/twin"
+)
+
+// Don't remember more jumps than this
+const maxJumpListLength = 100
+
+// A place to go back to. We store input line numbers rather than scroll
+// positions, so that positions stay put when wrapping is toggled or the
+// screen is resized.
+type _Position struct {
+	source             _SourceID
+	lineNumberOneBased int
+}
+
+func (p *Pager) currentPosition() _Position {
+	return _Position{
+		source:             p.currentSourceID(),
+		lineNumberOneBased: p.lineNumberOneBased(),
+	}
+}
+
+// Go to a position, switching files if needed. Returns false if the position
+// is in something we aren't showing any more.
+func (p *Pager) goToPosition(position _Position) bool {
+	if position.source != p.currentSourceID() {
+		fileIndex := -1
+		for i, file := range p.files {
+			if file.reader != nil && sourceID(file.reader, i) == position.source {
+				fileIndex = i
+				break
+			}
+		}
+		if fileIndex < 0 || p.isShowingHelp {
+			return false
+		}
+
+		p.saveFileState()
+		p.loadFileState(fileIndex)
+	}
+
+	p.scrollPosition = NewScrollPositionFromLineNumberOneBased(position.lineNumberOneBased, "goToPosition")
+	p.TargetLineNumberOneBased = 0
+	return true
+}
+
+// Call this before jumping somewhere, so that the user can get back here
+// using CTRL-o
+func (p *Pager) pushJump() {
+	p.pushJumpFrom(p.currentPosition())
+}
+
+// Call this after possibly jumping somewhere. If we did move, the user can get
+// back to before using CTRL-o.
+func (p *Pager) pushJumpIfMoved(before _Position) {
+	if p.currentPosition() == before {
+		return
+	}
+	p.pushJumpFrom(before)
+}
+
+func (p *Pager) pushJumpFrom(position _Position) {
+	if p.isShowingHelp {
+		return
+	}
+
+	// Jumping from somewhere in the middle of the jump list forgets about
+	// the newer jumps, just like in vim
+	p.jumps = p.jumps[:p.jumpIndex]
+
+	if len(p.jumps) == 0 || p.jumps[len(p.jumps)-1] != position {
+		p.jumps = append(p.jumps, position)
+	}
+	if len(p.jumps) > maxJumpListLength {
+		p.jumps = p.jumps[len(p.jumps)-maxJumpListLength:]
+	}
+
+	p.jumpIndex = len(p.jumps)
+}
+
+// CTRL-o, go back to where we were before the last jump
+func (p *Pager) jumpBack() {
+	if p.isShowingHelp {
+		return
+	}
+
+	if p.jumpIndex == 0 {
+		log.Debug("No older jumps")
+		return
+	}
+
+	if p.jumpIndex == len(p.jumps) {
+		// Remember where we are now, so that CTRL-i can get us back here
+		current := p.currentPosition()
+		if p.jumps[len(p.jumps)-1] != current {
+			p.jumps = append(p.jumps, current)
+		}
+	}
+
+	p.jumpIndex--
+	if !p.goToPosition(p.jumps[p.jumpIndex]) {
+		p.setStatusMessage("That position is gone")
+	}
+}
+
+// CTRL-i, undo a CTRL-o
+func (p *Pager) jumpForward() {
+	if p.isShowingHelp {
+		return
+	}
+
+	if p.jumpIndex >= len(p.jumps)-1 {
+		log.Debug("No newer jumps")
+		return
+	}
+
+	p.jumpIndex++
+	if !p.goToPosition(p.jumps[p.jumpIndex]) {
+		p.setStatusMessage("That position is gone")
+	}
+}
+
+// Marks and jumps pointing to oldReader should point to newReader instead
+func (p *Pager) replaceInPositions(oldReader *Reader, newReader *Reader) {
+	for name, mark := range p.marks {
+		if mark.source.reader == oldReader {
+			mark.source.reader = newReader
+			p.marks[name] = mark
+		}
+	}
+
+	for i := range p.jumps {
+		if p.jumps[i].source.reader == oldReader {
+			p.jumps[i].source.reader = newReader
+		}
+	}
+}
+
+func isMarkName(char rune) bool {
+	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z')
+}
+
+func (p *Pager) addMarkFooter() {
+	prompt := "Set mark: "
+	if p.mode == _GoingToMark {
+		prompt = "Go to mark: "
+	}
+
+	_, height := p.screen.Size()
+
+	pos := 0
+	for _, token := range prompt {
+		p.screen.SetCell(pos, height-1, twin.NewCell(token, twin.StyleDefault))
+		pos++
+	}
+
+	// Add a cursor
+	p.screen.SetCell(pos, height-1, twin.NewCell(' ', twin.StyleDefault.WithAttr(twin.AttrReverse)))
+}
+
+func (p *Pager) onMarkKey(key twin.KeyCode) {
+	switch key {
+	case twin.KeyEscape, twin.KeyEnter:
+		p.mode = _Viewing
+
+	default:
+		log.Tracef("Unhandled mark key event %v, treating as a viewing key event", key)
+		p.mode = _Viewing
+		p.onKey(key)
+	}
+}
+
+// Handle the second character of "ma" and "'a" commands
+func (p *Pager) onMarkRune(char rune) {
+	mode := p.mode
+	p.mode = _Viewing
+
+	if p.isShowingHelp {
+		return
+	}
+
+	if mode == _GoingToMark && char == '\'' {
+		// "''" goes back to where we were before the last jump, like in less
+		p.jumpBack()
+		return
+	}
+
+	if !isMarkName(char) {
+		log.Debugf("Not a mark name: '%s'/0x%08x", string(char), int32(char))
+		p.setStatusMessage("Marks are named a-z and A-Z")
+		return
+	}
+
+	if mode == _SettingMark {
+		if p.marks == nil {
+			p.marks = map[rune]_Position{}
+		}
+		p.marks[char] = p.currentPosition()
+		p.setStatusMessage(fmt.Sprintf("Mark '%c' set", char))
+		return
+	}
+
+	mark, found := p.marks[char]
+	if !found {
+		p.setStatusMessage(fmt.Sprintf("Mark '%c' not set", char))
+		return
+	}
+
+	p.pushJump()
+	if !p.goToPosition(mark) {
+		p.setStatusMessage(fmt.Sprintf("Mark '%c' is in a file we aren't showing", char))
+	}
+}
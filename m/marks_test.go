@@ -0,0 +1,151 @@
+package m
+
+import (
+	"testing"
+
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func typeRunes(pager *Pager, runes string) {
+	for _, char := range runes {
+		pager.onRune(char)
+	}
+}
+
+func gotoLine(pager *Pager, lineNumber string) {
+	typeRunes(pager, "g"+lineNumber)
+	pager.onKey(twin.KeyEnter)
+}
+
+func TestMarks(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+
+	gotoLine(pager, "30")
+	typeRunes(pager, "ma")
+	assert.Equal(t, pager.getStatusMessage(), "Mark 'a' set")
+
+	typeRunes(pager, "G")
+	typeRunes(pager, "'a")
+	assert.Equal(t, pager.lineNumberOneBased(), 30)
+
+	// Marks are input line numbers, so they shouldn't be affected by wrapping
+	// or resizing
+	typeRunes(pager, "<")
+	typeRunes(pager, "w")
+	pager.screen = twin.NewFakeScreen(5, 7)
+	typeRunes(pager, "'a")
+	pager.redraw("")
+	assert.Equal(t, pager.lineNumberOneBased(), 30)
+
+	typeRunes(pager, "'b")
+	assert.Equal(t, pager.getStatusMessage(), "Mark 'b' not set")
+
+	typeRunes(pager, "m1")
+	assert.Equal(t, pager.getStatusMessage(), "Marks are named a-z and A-Z")
+	assert.Equal(t, pager.mode, _Viewing)
+}
+
+func TestMarkInOtherFile(t *testing.T) {
+	first := NewReaderFromText("first", hundredLines())
+	second := NewReaderFromText("second", hundredLines())
+	assert.NilError(t, first._wait())
+	assert.NilError(t, second._wait())
+
+	pager := NewPagerFromReaders([]*Reader{first, second})
+	pager.screen = twin.NewFakeScreen(80, 10)
+
+	gotoLine(pager, "20")
+	typeRunes(pager, "mA")
+	typeRunes(pager, ":n")
+	assert.Equal(t, pager.reader, LineSource(second))
+
+	typeRunes(pager, "'A")
+	assert.Equal(t, pager.reader, LineSource(first))
+	assert.Equal(t, pager.lineNumberOneBased(), 20)
+}
+
+func TestJumpList(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+
+	gotoLine(pager, "50")
+	typeRunes(pager, "<")
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+
+	// CTRL-o takes us back
+	typeRunes(pager, "\x0f")
+	assert.Equal(t, pager.lineNumberOneBased(), 50)
+	typeRunes(pager, "\x0f")
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+	typeRunes(pager, "\x0f")
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+
+	// CTRL-i takes us forward again
+	typeRunes(pager, "\t")
+	assert.Equal(t, pager.lineNumberOneBased(), 50)
+	typeRunes(pager, "\t")
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+	typeRunes(pager, "\t")
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+
+	// "''" works like CTRL-o
+	gotoLine(pager, "70")
+	typeRunes(pager, "''")
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+}
+
+func TestJumpListSearch(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+
+	typeRunes(pager, "/Line 42")
+	pager.onKey(twin.KeyEnter)
+	assert.Assert(t, pager.lineNumberOneBased() > 1)
+
+	typeRunes(pager, "\x0f")
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+}
+
+// Searches that don't move us shouldn't end up in the jump list
+func TestJumpListSearchWithoutMoving(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+
+	// Already on screen
+	typeRunes(pager, "/Line 2")
+	pager.onKey(twin.KeyEnter)
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+
+	// Not found
+	typeRunes(pager, "/nothing")
+	pager.onKey(twin.KeyEscape)
+	typeRunes(pager, "p")
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+	assert.Equal(t, len(pager.jumps), 0)
+
+	// Moving, then going back using CTRL-o
+	gotoLine(pager, "50")
+	typeRunes(pager, "/Line 50")
+	pager.onKey(twin.KeyEnter)
+	typeRunes(pager, "N")
+	assert.Equal(t, len(pager.jumps), 1)
+	typeRunes(pager, "\x0f")
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+}
+
+// Jumping from the middle of the jump list should forget the newer jumps
+func TestJumpListTruncation(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+
+	gotoLine(pager, "10")
+	gotoLine(pager, "20")
+	typeRunes(pager, "\x0f\x0f") // Back to 1
+	gotoLine(pager, "30")
+
+	assert.Equal(t, len(pager.jumps), 1)
+
+	// Nothing newer to go to
+	typeRunes(pager, "\t")
+	assert.Equal(t, pager.lineNumberOneBased(), 30)
+
+	typeRunes(pager, "\x0f")
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+}
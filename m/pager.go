@@ -19,6 +19,9 @@ const (
 	_Searching
 	_NotFound
 	_GotoLine
+	_ColonCommand
+	_SettingMark
+	_GoingToMark
 )
 
 type StatusBarOption int
@@ -44,28 +47,67 @@ const (
 
 var unprintableStyle UnprintableStyle
 
+var rawCarriageReturns bool
+
 type eventSpinnerUpdate struct {
+	source  _SourceID
 	spinner string
 }
 
 type eventMoreLinesAvailable struct{}
 
+// Time to stop showing the status message, see setStatusMessage()
+type eventStatusMessageExpired struct{}
+
 // Either reading, highlighting or both are done. Check reader.Done() and
 // reader.HighlightingDone() for details.
 type eventMaybeDone struct{}
 
 // Pager is the main on-screen pager
 type Pager struct {
-	reader              *Reader
+	reader              LineSource
 	screen              twin.Screen
 	quit                bool
 	scrollPosition      scrollPosition
 	leftColumnZeroBased int
 
 	mode           _PagerMode
-	searchString   string
+	searchEditor   _LineEditor
 	searchPattern  *regexp.Regexp
-	gotoLineString string
+	gotoLineEditor _LineEditor
+
+	// True if the last search was started using CTRL-r. Makes 'n' search
+	// upwards and 'N' downwards.
+	searchBackwards bool
+
+	// Where we were when the search prompt was opened, for the jump list
+	searchStartPosition _Position
+
+	// Shown after the goto prompt if we couldn't make sense of what was typed
+	gotoLineError string
+
+	// Set using "ma", visited using "'a". See marks.go.
+	marks map[rune]_Position
+
+	// Where we jumped from, for CTRL-o and CTRL-i. jumpIndex is where in
+	// the list we are, len(jumps) unless we're going back and forth.
+	jumps     []_Position
+	jumpIndex int
+
+	// Earlier searches, oldest first, for browsing using the arrow keys in
+	// the search prompt. searchHistoryIndex is where in the history we are,
+	// len(searchHistory) means we're at searchDraft, the new search. See
+	// history.go.
+	searchHistory      []string
+	searchHistoryIndex int
+	searchDraft        string
+
+	// Searches made in this session, to be saved in StateFile
+	newSearches []string
+
+	// If non-zero, offer to go to this line, where the user was last time
+	// they viewed the current file
+	resumeLineNumberOneBased int
 
 	// We used to have a "Following" field here. If you want to follow, set
 	// TargetLineNumberOneBased to math.MaxInt instead, see below.
@@ -73,6 +115,39 @@ type Pager struct {
 	isShowingHelp bool
 	preHelpState  *_PreHelpState
 
+	// When toggling between text and hex views, this is where we were in the
+	// other view. See hexdump.go.
+	viewPositions map[*Reader]scrollPosition
+
+	// Readers we have already checked for binary contents, see
+	// maybeSwitchToHexView()
+	hexViewChecked map[*Reader]bool
+
+	// Readers we created ourselves, as opposed to the ones we were given.
+	// Only these are ours to stop, see stopReader().
+	ownReaders map[*Reader]bool
+
+	// All files we're paging. The state of the current file lives in the
+	// fields above, the entry for the current file in this slice is only
+	// updated when switching to some other file.
+	files            []_FileState
+	currentFileIndex int
+
+	// Set while reloading the current file, see reload.go
+	reloading *_Reload
+
+	// See PageOptions.KeyBindings and PageOptions.KeyCodeBindings
+	keyBindings     map[rune]func(p *Pager)
+	keyCodeBindings map[twin.KeyCode]func(p *Pager)
+
+	// If non-zero, we're still looking for the first hit of
+	// PageOptions.InitialSearch, starting at this line. See search.go.
+	initialSearchNextLine int
+
+	// Shown in the status bar instead of the help text until it expires
+	statusMessage        string
+	statusMessageExpires time.Time
+
 	// NewPager shows lines by default, this field can hide them
 	ShowLineNumbers bool
 
@@ -81,6 +156,11 @@ type Pager struct {
 
 	UnprintableStyle UnprintableStyle
 
+	// By default, carriage returns make the text after them overwrite the
+	// beginning of the line, just like in a terminal. If this is true they are
+	// shown as unprintable characters instead.
+	RawCarriageReturns bool
+
 	WrapLongLines bool
 
 	// Ref: https://github.com/walles/moar/issues/113
@@ -92,6 +172,14 @@ type Pager struct {
 
 	SideScrollAmount int // Should be positive
 
+	// If non-zero, reload the current input this often. Meant for running
+	// shell commands again, see NewReaderFromShellCommand().
+	ReloadInterval time.Duration
+
+	// If set, search history and the last viewed line of each file are
+	// remembered in this file between sessions. See DefaultStateFile().
+	StateFile string
+
 	// If non-zero, scroll to this line number as soon as possible. Set to
 	// math.MaxInt to follow the end of the input (tail).
 	TargetLineNumberOneBased int
@@ -110,7 +198,7 @@ type Pager struct {
 }
 
 type _PreHelpState struct {
-	reader                   *Reader
+	reader                   LineSource
 	scrollPosition           scrollPosition
 	leftColumnZeroBased      int
 	targetLineNumberOneBased int
@@ -126,6 +214,20 @@ Miscellaneous
 * Press 'q' or 'ESC' to quit
 * Press 'w' to toggle wrapping of long lines
 * Press '=' to toggle showing the status bar at the bottom
+* Press 'x' to toggle between text and hex views
+* Press 'R' to reload the current file from disk, or run the --exec command again
+* Press 'E' to show any errors reading the current file
+
+Multiple files
+--------------
+* Type ':n' to go to the next file
+* Type ':p' to go to the previous file
+
+Directories
+-----------
+* Up / down arrows or 'k' / 'j' move the selection
+* RETURN opens the selected file or directory
+* BACKSPACE goes back to the directory listing
 
 Moving around
 -------------
@@ -134,12 +236,16 @@ Moving around
 * Left / right can be used to hide / show line numbers
 * CTRL-p moves to the previous line
 * CTRL-n moves to the next line
-* 'g' for going to a specific line number
+* 'g' for going to a specific line number. Also try 50%, +10, -10, $ or
+  b1234 for the line containing byte offset 1234.
 * PageUp / 'b' and PageDown / 'f'
 * SPACE moves down a page
 * Home and End for start / end of the document
 * < / 'gg' to go to the start of the document
 * > / 'G' to go to the end of the document
+* 'm' plus a letter sets a mark, ' plus the same letter goes back there
+* CTRL-o / CTRL-i (TAB) go back / forward through where you jumped from
+* 'r' resumes where you were last time, if offered in the status bar
 * 'h', 'l' for left and right (as in vim)
 * Half page 'u'p / 'd'own, or CTRL-u / CTRL-d
 * RETURN moves down one line
@@ -147,9 +253,13 @@ Moving around
 Searching
 ---------
 * Type / to start searching, then type what you want to find
+* Type CTRL-r instead to search backwards, upwards from the top of the screen
 * Type RETURN to stop searching
-* Find next by typing 'n' (for "next")
-* Find previous by typing SHIFT-N or 'p' (for "previous")
+* Left / right arrows, Home and End move the cursor in the search and goto
+  prompts. CTRL-w deletes a word, CTRL-u clears the prompt.
+* Up / down arrows in the search prompt show earlier searches
+* Find next by typing 'n' (for "next"), in the direction of the last search
+* Find previous by typing SHIFT-N or 'p' (for "previous"), the other way
 * Search is case sensitive if it contains any UPPER CASE CHARACTERS
 * Search is interpreted as a regexp if it is a valid one
 
@@ -172,16 +282,75 @@ func (pm _PagerMode) isViewing() bool {
 	return pm == _Viewing || pm == _NotFound
 }
 
-// NewPager creates a new Pager with default settings
-func NewPager(r *Reader) *Pager {
-	var name string
-	if r == nil || r.name == nil || len(*r.name) == 0 {
-		name = "Pager"
-	} else {
-		name = "Pager " + *r.name
+// NewPager creates a new Pager with default settings. Pass it a *Reader, or your
+// own LineSource implementation.
+func NewPager(r LineSource) *Pager {
+	return newPagerFromSources([]LineSource{r})
+}
+
+// NewPagerFromReaders creates a new Pager with default settings, paging one or
+// more Readers. The first Reader is shown first, type ":n" / ":p" to move
+// between them.
+//
+// At least one Reader is required. To not have all files read up front, use
+// NewPagerFromFilenames() instead.
+func NewPagerFromReaders(readers []*Reader) *Pager {
+	sources := make([]LineSource, 0, len(readers))
+	for _, reader := range readers {
+		sources = append(sources, reader)
+	}
+	return newPagerFromSources(sources)
+}
+
+// NewPagerFromFilenames creates a new Pager with default settings, paging one
+// or more files. Type ":n" / ":p" to move between them.
+//
+// Files are opened by calling open(), the first one right away and the others
+// when the user first switches to them. If opening the first file fails, that
+// error is returned.
+func NewPagerFromFilenames(filenames []string, open func(filename string) (*Reader, error)) (*Pager, error) {
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("no files to page")
+	}
+
+	first, err := open(filenames[0])
+	if err != nil {
+		return nil, err
 	}
+
+	files := make([]_FileState, 0, len(filenames))
+	files = append(files, newFileState(first))
+	for _, filename := range filenames[1:] {
+		filename := filename
+		files = append(files, _FileState{
+			open: func() (*Reader, error) {
+				return open(filename)
+			},
+			scrollPosition: newScrollPosition("Pager " + filename),
+		})
+	}
+
+	pager := newPagerFromFiles(files)
+	pager.own(first)
+	return pager, nil
+}
+
+func newPagerFromSources(sources []LineSource) *Pager {
+	if len(sources) == 0 {
+		panic("At least one LineSource required")
+	}
+
+	files := make([]_FileState, 0, len(sources))
+	for _, source := range sources {
+		files = append(files, newFileState(source))
+	}
+
+	return newPagerFromFiles(files)
+}
+
+func newPagerFromFiles(files []_FileState) *Pager {
 	return &Pager{
-		reader:           r,
+		reader:           files[0].reader,
 		quit:             false,
 		ShowLineNumbers:  true,
 		ShowStatusBar:    true,
@@ -189,7 +358,8 @@ func NewPager(r *Reader) *Pager {
 		SideScrollAmount: 16,
 		ScrollLeftHint:   twin.NewCell('<', twin.StyleDefault.WithAttr(twin.AttrReverse)),
 		ScrollRightHint:  twin.NewCell('>', twin.StyleDefault.WithAttr(twin.AttrReverse)),
-		scrollPosition:   newScrollPosition(name),
+		scrollPosition:   files[0].scrollPosition,
+		files:            files,
 	}
 }
 
@@ -203,6 +373,29 @@ func (p *Pager) visibleHeight() int {
 	return height
 }
 
+// How long status messages are shown
+const statusMessageDuration = 3 * time.Second
+
+// Show a message in the status bar for a little while
+func (p *Pager) setStatusMessage(message string) {
+	p.statusMessage = message
+	p.statusMessageExpires = time.Now().Add(statusMessageDuration)
+
+	screen := p.screen
+	time.AfterFunc(statusMessageDuration, func() {
+		screen.Events() <- eventStatusMessageExpired{}
+	})
+}
+
+// The current status message, or "" if there is none
+func (p *Pager) getStatusMessage() string {
+	if time.Now().After(p.statusMessageExpires) {
+		return ""
+	}
+
+	return p.statusMessage
+}
+
 func (p *Pager) setFooter(footer string) {
 	width, height := p.screen.Size()
 
@@ -233,6 +426,21 @@ func (p *Pager) Quit() {
 	p.preHelpState = nil
 }
 
+// Show some text instead of the current file until the user presses 'q'
+func (p *Pager) showHelpReader(reader LineSource) {
+	p.preHelpState = &_PreHelpState{
+		reader:                   p.reader,
+		scrollPosition:           p.scrollPosition,
+		leftColumnZeroBased:      p.leftColumnZeroBased,
+		targetLineNumberOneBased: p.TargetLineNumberOneBased,
+	}
+	p.reader = reader
+	p.scrollPosition = newScrollPosition("Pager scroll position")
+	p.leftColumnZeroBased = 0
+	p.TargetLineNumberOneBased = 0
+	p.isShowingHelp = true
+}
+
 // Negative deltas move left instead
 func (p *Pager) moveRight(delta int) {
 	if p.ShowLineNumbers && delta > 0 {
@@ -280,12 +488,30 @@ func (p *Pager) onKey(keyCode twin.KeyCode) {
 		p.onGotoLineKey(keyCode)
 		return
 	}
+	if p.mode == _ColonCommand {
+		p.onColonKey(keyCode)
+		return
+	}
+	if p.mode == _SettingMark || p.mode == _GoingToMark {
+		p.onMarkKey(keyCode)
+		return
+	}
 	if p.mode != _Viewing && p.mode != _NotFound {
 		panic(fmt.Sprint("Unhandled mode: ", p.mode))
 	}
 
+	if binding, found := p.keyCodeBindings[keyCode]; found {
+		binding(p)
+		return
+	}
+
 	// Reset the not-found marker on non-search keypresses
 	p.mode = _Viewing
+	p.resumeLineNumberOneBased = 0
+
+	if p.currentListing() != nil && p.onListingKey(keyCode) {
+		return
+	}
 
 	switch keyCode {
 	case twin.KeyEscape:
@@ -301,6 +527,9 @@ func (p *Pager) onKey(keyCode twin.KeyCode) {
 		p.scrollPosition = p.scrollPosition.NextLine(1)
 		p.handleScrolledDown()
 
+	case twin.KeyBackspace:
+		p.backToListing()
+
 	case twin.KeyRight:
 		p.moveRight(p.SideScrollAmount)
 
@@ -314,10 +543,12 @@ func (p *Pager) onKey(keyCode twin.KeyCode) {
 		p.moveRight(-1)
 
 	case twin.KeyHome:
+		p.pushJump()
 		p.scrollPosition = newScrollPosition("Pager scroll position")
 		p.handleScrolledUp()
 
 	case twin.KeyEnd:
+		p.pushJump()
 		p.scrollToEnd()
 
 	case twin.KeyPgUp:
@@ -342,29 +573,44 @@ func (p *Pager) onRune(char rune) {
 		p.onGotoLineRune(char)
 		return
 	}
+	if p.mode == _ColonCommand {
+		p.onColonRune(char)
+		return
+	}
+	if p.mode == _SettingMark || p.mode == _GoingToMark {
+		p.onMarkRune(char)
+		return
+	}
 	if p.mode != _Viewing && p.mode != _NotFound {
 		panic(fmt.Sprint("Unhandled mode: ", p.mode))
 	}
 
+	if binding, found := p.keyBindings[char]; found {
+		binding(p)
+		return
+	}
+
+	if p.currentListing() != nil && p.onListingRune(char) {
+		return
+	}
+
+	if char != 'r' {
+		// The offer to resume is only good until the user does something else
+		p.resumeLineNumberOneBased = 0
+	}
+
 	switch char {
 	case 'q':
 		p.Quit()
 
 	case '?':
 		if !p.isShowingHelp {
-			p.preHelpState = &_PreHelpState{
-				reader:                   p.reader,
-				scrollPosition:           p.scrollPosition,
-				leftColumnZeroBased:      p.leftColumnZeroBased,
-				targetLineNumberOneBased: p.TargetLineNumberOneBased,
-			}
-			p.reader = _HelpReader
-			p.scrollPosition = newScrollPosition("Pager scroll position")
-			p.leftColumnZeroBased = 0
-			p.TargetLineNumberOneBased = 0
-			p.isShowingHelp = true
+			p.showHelpReader(_HelpReader)
 		}
 
+	case 'E':
+		p.showProblems()
+
 	case '=':
 		p.ShowStatusBar = !p.ShowStatusBar
 
@@ -391,10 +637,12 @@ func (p *Pager) onRune(char rune) {
 		p.moveRight(-p.SideScrollAmount)
 
 	case '<':
+		p.pushJump()
 		p.scrollPosition = newScrollPosition("Pager scroll position")
 		p.handleScrolledUp()
 
 	case '>', 'G':
+		p.pushJump()
 		p.scrollToEnd()
 
 	case 'f', ' ':
@@ -418,28 +666,92 @@ func (p *Pager) onRune(char rune) {
 		p.handleScrolledDown()
 
 	case '/':
-		p.mode = _Searching
-		p.searchString = ""
-		p.searchPattern = nil
+		p.startSearch(false)
+
+	// '\x12' = CTRL-r, search backwards like in Emacs. '?' would have been
+	// the less / vim key for this, but that's our help key.
+	case '\x12':
+		p.startSearch(true)
 
 	case 'g':
 		p.mode = _GotoLine
-		p.gotoLineString = ""
+		p.gotoLineEditor.setText("")
+		p.gotoLineError = ""
+
+	case ':':
+		p.mode = _ColonCommand
+
+	case 'm':
+		p.mode = _SettingMark
+
+	case '\'':
+		p.mode = _GoingToMark
 
+	// '\x0f' = CTRL-o, like in vim
+	case '\x0f':
+		p.jumpBack()
+
+	// '\t' = CTRL-i, like in vim
+	case '\t':
+		p.jumpForward()
+
+	// 'n' goes on in the direction of the last search, 'N' and 'p' the other
+	// way, like in less and vim
 	case 'n':
-		p.scrollToNextSearchHit()
+		before := p.currentPosition()
+		if p.searchBackwards {
+			p.scrollToPreviousSearchHit()
+		} else {
+			p.scrollToNextSearchHit()
+		}
+		p.pushJumpIfMoved(before)
 
 	case 'p', 'N':
-		p.scrollToPreviousSearchHit()
+		before := p.currentPosition()
+		if p.searchBackwards {
+			p.scrollToNextSearchHit()
+		} else {
+			p.scrollToPreviousSearchHit()
+		}
+		p.pushJumpIfMoved(before)
 
 	case 'w':
 		p.WrapLongLines = !p.WrapLongLines
 
+	case 'x':
+		p.toggleHexView()
+
+	case 'R':
+		p.reload()
+
+	case 'r':
+		p.resume()
+
+	case '\b':
+		p.backToListing()
+
 	default:
 		log.Debugf("Unhandled rune keypress '%s'/0x%08x", string(char), int32(char))
 	}
 }
 
+// Pasted text goes into the prompts. When viewing we ignore it rather than
+// running each pasted character as a command.
+func (p *Pager) onPaste(text string) {
+	switch p.mode {
+	case _Searching:
+		p.searchEditor.paste(text)
+		p.updateSearchPattern()
+
+	case _GotoLine:
+		p.gotoLineEditor.paste(text)
+		p.gotoLineError = ""
+
+	default:
+		log.Debugf("Ignoring paste of %d bytes in mode %v", len(text), p.mode)
+	}
+}
+
 // Return an ANSI SGR sequence to use for plain text. Can be "".
 func getLineColorPrefix(chromaStyle *chroma.Style, chromaFormatter *chroma.Formatter) string {
 	if chromaStyle == nil && chromaFormatter == nil {
@@ -467,26 +779,35 @@ func getLineColorPrefix(chromaStyle *chroma.Style, chromaFormatter *chroma.Forma
 	return formatted[:cutoff]
 }
 
-// StartPaging brings up the pager on screen
-func (p *Pager) StartPaging(screen twin.Screen, chromaStyle *chroma.Style, chromaFormatter *chroma.Formatter) {
-	log.Trace("Pager starting")
-	defer log.Trace("Pager done")
+// Forward events from one of our Readers to the main loop. Must be called at
+// most once per Reader, since its channels can only have one consumer each.
+//
+// Forwarding ends when the Reader is stopped.
+func (p *Pager) watchReader(reader *Reader) {
+	p.watchSource(reader, sourceID(reader, -1))
+}
 
-	defer func() {
-		if p.reader.err != nil {
-			log.Warnf("Reader reported an error: %s", p.reader.err.Error())
-		}
-	}()
+// Like watchReader(), but for any LineSource. See _SourceID for what id is.
+func (p *Pager) watchSource(reader LineSource, id _SourceID) {
+	screen := p.screen
 
-	unprintableStyle = p.UnprintableStyle
-	consumeLessTermcapEnvs(chromaStyle, chromaFormatter)
-	styleUI(chromaStyle, chromaFormatter, p.StatusBarStyle)
-
-	p.screen = screen
-	p.linePrefix = getLineColorPrefix(chromaStyle, chromaFormatter)
+	// Never closed for LineSources that aren't ours
+	var stopped <-chan struct{}
+	if ours := asReader(reader); ours != nil {
+		stopped = ours.stoppedChannel()
+	}
 
 	go func() {
-		for range p.reader.moreLinesAdded {
+		for {
+			select {
+			case <-stopped:
+				return
+			case _, ok := <-reader.MoreLinesAdded():
+				if !ok {
+					return
+				}
+			}
+
 			// Notify the main loop about the new lines so it can show them
 			screen.Events() <- eventMoreLinesAvailable{}
 
@@ -504,43 +825,180 @@ func (p *Pager) StartPaging(screen twin.Screen, chromaStyle *chroma.Style, chrom
 		// Spin the spinner as long as contents is still loading
 		spinnerFrames := [...]string{"/.\\", "-o-", "\\O/", "| |"}
 		spinnerIndex := 0
+		spinner := ""
+		ours := asReader(reader)
 		for {
-			if p.reader.done.Load() {
+			if reader.Done() {
 				break
 			}
 
-			screen.Events() <- eventSpinnerUpdate{spinnerFrames[spinnerIndex]}
-			spinnerIndex++
-			if spinnerIndex >= len(spinnerFrames) {
-				spinnerIndex = 0
+			if ours != nil && ours.isCaughtUp() {
+				// Following a file that isn't growing right now, nothing is
+				// loading
+				if spinner != "" {
+					spinner = ""
+					screen.Events() <- eventSpinnerUpdate{id, spinner}
+				}
+			} else {
+				spinner = spinnerFrames[spinnerIndex]
+				screen.Events() <- eventSpinnerUpdate{id, spinner}
+				spinnerIndex++
+				if spinnerIndex >= len(spinnerFrames) {
+					spinnerIndex = 0
+				}
 			}
 
-			time.Sleep(200 * time.Millisecond)
+			select {
+			case <-stopped:
+				return
+			case <-time.After(200 * time.Millisecond):
+			}
 		}
 
 		// Empty our spinner, loading done!
-		screen.Events() <- eventSpinnerUpdate{""}
+		screen.Events() <- eventSpinnerUpdate{id, ""}
 	}()
 
 	go func() {
-		for range p.reader.maybeDone {
+		for {
+			select {
+			case <-stopped:
+				return
+			case _, ok := <-reader.MaybeDone():
+				if !ok {
+					return
+				}
+			}
+
 			screen.Events() <- eventMaybeDone{}
 		}
 	}()
+}
+
+// All Readers we're showing or can get back to. That's our files, plus the
+// directory listings they were opened from.
+func (p *Pager) openReaders() []*Reader {
+	sources := []LineSource{p.reader}
+	if p.preHelpState != nil {
+		sources = append(sources, p.preHelpState.reader)
+	}
+	for _, file := range p.files {
+		sources = append(sources, file.reader)
+	}
+
+	seen := map[*Reader]bool{}
+	readers := []*Reader{}
+	for _, source := range sources {
+		// Other LineSources are not ours, not our business
+		reader := asReader(source)
+		for reader != nil {
+			if reader.hexDumpOf != nil {
+				reader = reader.hexDumpOf
+			}
+			if seen[reader] {
+				break
+			}
+			seen[reader] = true
+			readers = append(readers, reader)
+
+			reader.Lock()
+			openedFrom := reader.openedFrom
+			reader.Unlock()
+			if openedFrom == nil {
+				break
+			}
+			reader = asReader(openedFrom.reader)
+		}
+	}
+
+	return readers
+}
+
+// Remember that we created this Reader ourselves, so that we'll stop it when
+// we're done with it
+func (p *Pager) own(reader *Reader) {
+	if p.ownReaders == nil {
+		p.ownReaders = map[*Reader]bool{}
+	}
+	p.ownReaders[reader] = true
+}
+
+// Call this when we're done with a Reader. Readers we were given are left
+// running, our caller may still want to use them after we're done. Any hex
+// dumps we made of them are ours though.
+func (p *Pager) stopReader(reader *Reader) {
+	if !p.ownReaders[reader] {
+		reader.stopHexDump()
+		return
+	}
+
+	reader.stop()
+	reader.runLessClose()
+}
+
+// StartPaging brings up the pager on screen
+func (p *Pager) StartPaging(screen twin.Screen, chromaStyle *chroma.Style, chromaFormatter *chroma.Formatter) {
+	log.Trace("Pager starting")
+	defer log.Trace("Pager done")
+
+	defer func() {
+		for _, reader := range p.openReaders() {
+			if err := reader.Err(); err != nil {
+				log.Warnf("Reader reported an error: %s", err.Error())
+			}
+
+			p.stopReader(reader)
+		}
+	}()
+
+	unprintableStyle = p.UnprintableStyle
+	rawCarriageReturns = p.RawCarriageReturns
+	consumeLessTermcapEnvs(chromaStyle, chromaFormatter)
+	styleUI(chromaStyle, chromaFormatter, p.StatusBarStyle)
+
+	p.screen = screen
+	p.linePrefix = getLineColorPrefix(chromaStyle, chromaFormatter)
+
+	for i, file := range p.files {
+		if i != p.currentFileIndex {
+			// Any initial target line number (like when following) applies
+			// to all files
+			p.files[i].targetLineNumberOneBased = p.TargetLineNumberOneBased
+		}
+
+		if file.reader != nil {
+			p.watchSource(file.reader, sourceID(file.reader, i))
+		}
+	}
+
+	if p.ReloadInterval > 0 {
+		p.reloadPeriodically()
+	}
+
+	p.loadHistory()
 
 	// Main loop
-	spinner := ""
+	spinners := map[_SourceID]string{}
 	for !p.quit {
+		p.maybeUseReplacements()
+		p.maybeSwitchToHexView()
+		p.maybeReportReload()
+		p.maybeScrollToInitialSearchHit()
+		spinner := spinners[p.currentSourceID()]
+		if p.reloading != nil && p.reloading.previousRun == p.reader {
+			// Show that we're running the command again
+			spinner = spinners[sourceID(p.reloading.reader, -1)]
+		}
 		if len(screen.Events()) == 0 {
 			// Nothing more to process for now, redraw the screen
 			overflow := p.redraw(spinner)
 
 			// Ref:
 			// https://github.com/gwsw/less/blob/ff8869aa0485f7188d942723c9fb50afb1892e62/command.c#L828-L831
-			if p.QuitIfOneScreen && overflow == didFit && !p.isShowingHelp {
+			if p.QuitIfOneScreen && overflow == didFit && !p.isShowingHelp && len(p.files) <= 1 {
 				// Do the slow (atomic) checks only if the fast ones (no locking
 				// required) passed
-				if p.reader.done.Load() && p.reader.highlightingDone.Load() {
+				if p.reader.Done() {
 					// Ref:
 					// https://github.com/walles/moar/issues/113#issuecomment-1368294132
 					p.ShowLineNumbers = false // Requires a redraw to take effect, see below
@@ -565,6 +1023,10 @@ func (p *Pager) StartPaging(screen twin.Screen, chromaStyle *chroma.Style, chrom
 			log.Tracef("Handling rune event '%c'/0x%04x...", event.Rune(), event.Rune())
 			p.onRune(event.Rune())
 
+		case twin.EventPaste:
+			log.Tracef("Handling paste event of %d bytes...", len(event.Text()))
+			p.onPaste(event.Text())
+
 		case twin.EventMouse:
 			log.Tracef("Handling mouse event %d...", event.Buttons())
 			switch event.Buttons() {
@@ -588,7 +1050,7 @@ func (p *Pager) StartPaging(screen twin.Screen, chromaStyle *chroma.Style, chrom
 
 		case twin.EventExit:
 			log.Debug("Got a Twin exit event, exiting")
-			return
+			p.quit = true
 
 		case eventMoreLinesAvailable:
 			if p.mode.isViewing() && p.TargetLineNumberOneBased > 0 {
@@ -607,12 +1069,27 @@ func (p *Pager) StartPaging(screen twin.Screen, chromaStyle *chroma.Style, chrom
 			// check (above) as soon as highlighting is done.
 
 		case eventSpinnerUpdate:
-			spinner = event.spinner
+			spinners[event.source] = event.spinner
+
+		case eventReloadTimer:
+			if p.reloading == nil {
+				p.startReload(true)
+			}
+
+		case eventContextDone:
+			log.Debug("Context done, exiting")
+			p.quit = true
+
+		case eventStatusMessageExpired:
+			// Do nothing. We got this just so that we'll redraw without the
+			// message.
 
 		default:
 			log.Warnf("Unhandled event type: %v", event)
 		}
 	}
+
+	p.saveHistory()
 }
 
 // After the pager has exited and the normal screen has been restored, you can
@@ -669,3 +669,110 @@ func BenchmarkHighlightedSearch(b *testing.B) {
 func BenchmarkPlainTextSearch(b *testing.B) {
 	benchmarkSearch(b, false)
 }
+
+func TestSwitchFiles(t *testing.T) {
+	first := NewReaderFromText("first", strings.Repeat("first\n", 100))
+	second := NewReaderFromText("second", strings.Repeat("second\n", 100))
+
+	pager := NewPagerFromReaders([]*Reader{first, second})
+	pager.screen = twin.NewFakeScreen(20, 10)
+
+	pager.scrollPosition = NewScrollPositionFromLineNumberOneBased(42, "TestSwitchFiles")
+	pager.leftColumnZeroBased = 3
+	pager.searchEditor.setText("irs")
+	pager.searchPattern = toPattern(pager.searchEditor.text)
+
+	pager.onRune(':')
+	pager.onRune('n')
+	assert.Equal(t, pager.reader, second)
+	assert.Equal(t, pager.fileIndicator(), "file 2/2")
+	assert.Equal(t, pager.lineNumberOneBased(), 1)
+	assert.Equal(t, pager.leftColumnZeroBased, 0)
+	assert.Equal(t, pager.searchEditor.text, "")
+	assert.Assert(t, pager.searchPattern == nil)
+
+	// There is no third file, so this should do nothing
+	pager.onRune(':')
+	pager.onRune('n')
+	assert.Equal(t, pager.reader, second)
+	assert.Equal(t, pager.mode, _Viewing)
+
+	// Going back should restore everything
+	pager.onRune(':')
+	pager.onRune('p')
+	assert.Equal(t, pager.reader, first)
+	assert.Equal(t, pager.fileIndicator(), "file 1/2")
+	assert.Equal(t, pager.lineNumberOneBased(), 42)
+	assert.Equal(t, pager.leftColumnZeroBased, 3)
+	assert.Equal(t, pager.searchEditor.text, "irs")
+	assert.Assert(t, pager.searchPattern != nil)
+}
+
+// Files shouldn't be opened until the user switches to them
+func TestSwitchFilesOpensLazily(t *testing.T) {
+	opened := []string{}
+	open := func(filename string) (*Reader, error) {
+		if filename == "missing" {
+			return nil, fmt.Errorf("no such file: %s", filename)
+		}
+		opened = append(opened, filename)
+		return NewReaderFromText(filename, filename), nil
+	}
+
+	pager, err := NewPagerFromFilenames([]string{"first", "second", "missing"}, open)
+	assert.NilError(t, err)
+	pager.screen = twin.NewFakeScreen(20, 10)
+	assert.Equal(t, len(opened), 1)
+	assert.Equal(t, pager.fileIndicator(), "file 1/3")
+
+	typeRunes(pager, ":n")
+	assert.Equal(t, pager.reader.GetLine(1).Plain(nil), "second")
+	assert.Equal(t, len(opened), 2)
+
+	// Going back and forth shouldn't open anything again
+	typeRunes(pager, ":p:n")
+	assert.Equal(t, pager.reader.GetLine(1).Plain(nil), "second")
+	assert.Equal(t, len(opened), 2)
+
+	// Failing to open a file should keep us where we are
+	typeRunes(pager, ":n")
+	assert.Equal(t, pager.reader.GetLine(1).Plain(nil), "second")
+	assert.Equal(t, pager.fileIndicator(), "file 2/3")
+	assert.Equal(t, pager.getStatusMessage(), "no such file: missing")
+
+	_, err = NewPagerFromFilenames([]string{"missing", "first"}, open)
+	assert.Error(t, err, "no such file: missing")
+	_, err = NewPagerFromFilenames([]string{}, open)
+	assert.Error(t, err, "no files to page")
+}
+
+// Readers we were given should still be usable after paging, the ones we
+// created ourselves should be stopped
+func TestExitStopsOnlyOwnReaders(t *testing.T) {
+	given := NewReaderFromText("given", "given")
+	pager := NewPagerFromReaders([]*Reader{given, given})
+	pager.screen = twin.NewFakeScreen(20, 10)
+	typeRunes(pager, "x") // Hex view
+	hexDump := given.hexDump
+	assert.Assert(t, hexDump != nil)
+
+	pager.Quit()
+	pager.StartPaging(pager.screen, nil, nil)
+	assert.Assert(t, !given.stopped.Load())
+	assert.Assert(t, hexDump.stopped.Load())
+
+	var opened *Reader
+	pager, err := NewPagerFromFilenames([]string{"opened"}, func(filename string) (*Reader, error) {
+		opened = NewReaderFromText(filename, filename)
+		return opened, nil
+	})
+	assert.NilError(t, err)
+	pager.Quit()
+	pager.StartPaging(twin.NewFakeScreen(20, 10), nil, nil)
+	assert.Assert(t, opened.stopped.Load())
+}
+
+func TestSingleFileHasNoFileIndicator(t *testing.T) {
+	pager := NewPager(NewReaderFromText("single", "a"))
+	assert.Equal(t, pager.fileIndicator(), "")
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -17,13 +18,20 @@ import (
 	"github.com/alecthomas/chroma/v2"
 	"github.com/alecthomas/chroma/v2/lexers"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/encoding"
 )
 
-// Files larger than this won't be highlighted
+// We highlight at most this many bytes at a time. Larger inputs are highlighted
+// as streams, in chunks of highlightChunkLines lines, see highlightStream().
 //
 //revive:disable-next-line:var-naming
 const MAX_HIGHLIGHT_SIZE int64 = 1024 * 1024
 
+// Streams are highlighted in chunks of this many lines, see highlightStream().
+//
+// It's a variable so that the tests can change it.
+var highlightChunkLines = 1000
+
 // Reader reads a file into an array of strings.
 //
 // It does the reading in the background, and it returns parts of the read data
@@ -36,19 +44,134 @@ type Reader struct {
 	lines   []*Line
 	name    *string
 	err     error
-	_stderr io.Reader
+	_stderr *_FilterStderr
+
+	// Whatever our filter printed to stderr, shown to the user on request.
+	// See errors.go.
+	filterStderr string
 
 	// Have we had our contents replaced using setText()?
 	replaced bool
 
+	// Keep reading after EOF, see ReaderOptions.Follow
+	following bool
+
+	// Set if the last line didn't end with a newline. More text may be added
+	// to it later, see addLine().
+	lastLineIsPartial bool
+
+	// If we're following a file and it got truncated or rotated, this says
+	// which one it was and when, for the status bar. See follow.go.
+	reopenedReason string
+	reopenedAt     time.Time
+
+	// LESSCLOSE command to run when we're done with this reader, see
+	// lessopen.go
+	lessClose     string
+	lessCloseOnce sync.Once
+
+	// Set if we're showing the output of a slow LESSOPEN preprocessor. If it
+	// turns out to have nothing to say, the pager should switch to showing
+	// the original file instead. See replacement().
+	lessOpenOutput *_LessOpenOutput
+
+	// See ReaderOptions.Encoding
+	forcedEncoding encoding.Encoding
+
+	// Non-empty if we figured out the language to highlight from the
+	// contents. Shown in the status bar. See detectLanguage.go.
+	detectedLanguage string
+
+	// Non-empty if we're decoding the input from something other than UTF-8.
+	// Shown in the status bar. See encoding.go.
+	encodingName string
+
+	// Set if the input looks like a binary file, see hexdump.go
+	binary atomic.Bool
+
+	// The hex dump view of this Reader, created on demand. See hexdump.go.
+	hexDump *Reader
+
+	// If this Reader is a hex dump, this is the Reader it is a dump of
+	hexDumpOf *Reader
+
+	// For hex dumping. Files we just read again, for streams we keep a copy
+	// of the first rawBytesLimit bytes we read, and text we already have.
+	// Only one of these will be set.
+	sourceFile *string
+	rawBytes   *rawBytes
+	text       *string
+
+	// Opens this file again, from scratch. Nil for streams. See reload.go.
+	reopen func() (*Reader, error)
+
+	// Set if we're showing the output of a shell command. Reloading runs the
+	// command again. See NewReaderFromShellCommand().
+	shellCommand string
+
+	// The output of the previous run of our shell command, for showing what
+	// changed. See watch.go.
+	previousRun *Reader
+
+	// Set if this Reader lists the files in a directory, see directory.go
+	listing *_DirectoryListing
+
+	// Set if this file was opened from a directory listing, so that we can
+	// go back there. See directory.go.
+	openedFrom *_ListingPosition
+
+	// Set for large files. If set, lines are read on demand from here
+	// rather than being kept in the lines slice. See lazyReader.go.
+	lazy *lazyLines
+
 	done             *atomic.Bool
 	highlightingDone *atomic.Bool
 
+	// Set when nobody will be looking at this Reader any more, see stop()
+	stopped atomic.Bool
+
+	// Followed files are never done. These say whether we have read and
+	// highlighted everything there is for now, see isCaughtUp().
+	readingCaughtUp      atomic.Bool
+	highlightingCaughtUp atomic.Bool
+
+	// Closed by stop(), created on demand. See stoppedChannel().
+	stoppedChan chan struct{}
+
 	// For telling the UI it should recheck the --quit-if-one-screen conditions.
-	// Signalled when either highlighting is done or reading is done.
+	// Signalled when either highlighting is done or reading is done, see
+	// reportMaybeDone().
 	maybeDone chan bool
 
+	// Closed when we're Done(), created on demand. See doneChannel().
+	doneChan chan struct{}
+
 	moreLinesAdded chan bool
+
+	// For telling highlightStream() there are more lines for it to highlight,
+	// or that reading is done. Nil if we aren't highlighting.
+	moreLinesToHighlight chan bool
+}
+
+// ReaderOptions control how a Reader reads its input. The zero value gives
+// you the defaults.
+type ReaderOptions struct {
+	// Keep polling files for more lines after reaching the end, just like
+	// "tail -f". Has no effect on streams or compressed files.
+	Follow bool
+
+	// Input preprocessor for files, same format as the LESSOPEN environment
+	// variable used by less. Empty means no preprocessing. See lessopen.go.
+	LessOpen string
+
+	// Run after we're done with a LessOpen preprocessed file, same format as
+	// the LESSCLOSE environment variable used by less.
+	LessClose string
+
+	// The input will be decoded from this encoding into UTF-8. If nil, we
+	// guess the encoding from the first bytes of the input. Set it to
+	// unicode.UTF8 to skip guessing.
+	Encoding encoding.Encoding
 }
 
 // InputLines contains a number of lines from the reader, plus metadata
@@ -66,8 +189,11 @@ type InputLines struct {
 func (reader *Reader) cleanupFilter(fromFilter *exec.Cmd) {
 	defer func() {
 		reader.done.Store(true)
+		reader.reportMaybeDone()
+
+		// Have the highlighter do the last line as well
 		select {
-		case reader.maybeDone <- true:
+		case reader.moreLinesToHighlight <- true:
 		default:
 		}
 	}()
@@ -79,8 +205,15 @@ func (reader *Reader) cleanupFilter(fromFilter *exec.Cmd) {
 		return
 	}
 
+	if fromFilter.ProcessState != nil {
+		// Somebody already waited for it, see _LessOpenOutput
+		log.Trace("Reader done, filter already done")
+		return
+	}
+
 	reader.Lock()
-	defer reader.Unlock()
+	stderr := reader._stderr
+	reader.Unlock()
 
 	// Give the filter a little time to go away
 	timer := time.AfterFunc(2*time.Second, func() {
@@ -91,31 +224,77 @@ func (reader *Reader) cleanupFilter(fromFilter *exec.Cmd) {
 		_ = fromFilter.Process.Kill()
 	})
 
-	stderrText := ""
-	if reader._stderr != nil {
-		// Drain the reader's stderr into a string for possible inclusion in an error message
-		// From: https://stackoverflow.com/a/9650373/473672
-		if buffer, err := io.ReadAll(reader._stderr); err == nil {
-			stderrText = strings.TrimSpace(string(buffer))
-		} else {
-			log.Warn("Draining filter stderr failed: ", err)
-		}
+	stderrText, err := waitForFilter(fromFilter, stderr)
+	timer.Stop()
+
+	reader.setFilterResult(stderrText, err)
+
+	log.Trace("Reader done, filter done")
+}
+
+// Wait for a filter's stderr to be drained, then for the filter to exit. If the
+// filter failed, the returned error includes what it said on stderr.
+func waitForFilter(filter *exec.Cmd, stderr *_FilterStderr) (string, error) {
+	stderrText := stderr.wait()
+
+	err := filter.Wait()
+	if err != nil && stderrText != "" {
+		err = fmt.Errorf("%s: %w", stderrText, err)
 	}
 
-	err := fromFilter.Wait()
-	timer.Stop()
+	return stderrText, err
+}
+
+// Remember what a filter said on stderr and how it exited, for showing to the
+// user. See errors.go.
+func (reader *Reader) setFilterResult(stderrText string, err error) {
+	reader.Lock()
+	defer reader.Unlock()
+
+	reader.filterStderr = stderrText
 
 	// Don't overwrite any existing problem report
 	if reader.err == nil {
 		reader.err = err
-		if err != nil && stderrText != "" {
-			reader.err = fmt.Errorf("%s: %w", stderrText, err)
-		}
 	}
+}
 
-	// FIXME: Report any filter printouts to stderr to the user
+// Call this when nobody will be looking at this Reader any more. Stops any
+// background reading and closes any file we are reading from.
+func (reader *Reader) stop() {
+	if reader.stopped.Swap(true) {
+		// Already stopped
+		return
+	}
 
-	log.Trace("Reader done, filter done")
+	reader.Lock()
+	if reader.stoppedChan != nil {
+		close(reader.stoppedChan)
+	}
+	if reader.lazy != nil {
+		reader.lazy.close()
+	}
+	hexDump := reader.hexDump
+	reader.Unlock()
+
+	if hexDump != nil {
+		hexDump.stop()
+	}
+}
+
+// Gets closed when stop() is called
+func (reader *Reader) stoppedChannel() <-chan struct{} {
+	reader.Lock()
+	defer reader.Unlock()
+
+	if reader.stoppedChan == nil {
+		reader.stoppedChan = make(chan struct{})
+		if reader.stopped.Load() {
+			close(reader.stoppedChan)
+		}
+	}
+
+	return reader.stoppedChan
 }
 
 // Count lines in the original file and preallocate space for them.  Good
@@ -151,80 +330,168 @@ func (reader *Reader) preAllocLines(originalFileName string) {
 	}
 }
 
+// How long to wait before checking for more input when following a file
+const followPollInterval = 200 * time.Millisecond
+
 // This function will be update the Reader struct in the background.
-func (reader *Reader) readStream(stream io.Reader, originalFileName *string, fromFilter *exec.Cmd, onDone func()) {
+//
+// Closeable streams are closed when we're done reading them.
+func (reader *Reader) readStream(stream io.Reader, originalFileName *string, fromFilter *exec.Cmd) {
 	defer reader.cleanupFilter(fromFilter)
 
+	// Updated if the file we're following gets rotated
+	closer, _ := stream.(io.Closer)
+	defer func() {
+		if closer == nil {
+			return
+		}
+		if err := closer.Close(); err != nil {
+			log.Debug("Failed to close input stream: ", err)
+		}
+	}()
+
 	if originalFileName != nil {
 		reader.preAllocLines(*originalFileName)
 	}
 
-	bufioReader := bufio.NewReader(stream)
+	if reader.rawBytes != nil {
+		stream = io.TeeReader(stream, reader.rawBytes)
+		defer reader.rawBytes.close()
+	}
+
+	bufioReader := bufio.NewReader(reader.newDecodingStream(stream))
 	completeLine := make([]byte, 0)
+
+	// When following, we show lines without trailing newlines as soon as we
+	// get them. If more text arrives for such a line, we replace it rather
+	// than adding a new line.
+	lastLineIsPartial := false
+
 	t0 := time.Now().UnixNano()
 	for {
-		keepReadingLine := true
-		eof := false
+		lineBytes, err := bufioReader.ReadSlice('\n')
+		completeLine = append(completeLine, lineBytes...)
+		if err == bufio.ErrBufferFull {
+			// Line longer than our buffer, keep reading
+			continue
+		}
 
-		var lineBytes []byte
-		var err error
-		for keepReadingLine {
-			lineBytes, keepReadingLine, err = bufioReader.ReadLine()
-			if err != nil {
-				if err == io.EOF {
-					eof = true
-					break
-				}
+		eof := false
+		if err == io.EOF {
+			eof = true
+		} else if err != nil {
+			reader.Lock()
+			if reader.err == nil {
+				// Store the error unless it overwrites one we already have
+				reader.err = fmt.Errorf("error reading line from input stream: %w", err)
+			}
+			reader.Unlock()
+			break
+		}
 
-				reader.Lock()
-				if reader.err == nil {
-					// Store the error unless it overwrites one we already have
-					reader.err = fmt.Errorf("error reading line from input stream: %w", err)
-				}
-				reader.Unlock()
+		if len(lineBytes) > 0 {
+			reader.readingCaughtUp.Store(false)
+			if !reader.addLine(completeLine, lastLineIsPartial) {
+				// Somebody called setText(), never mind reading the rest of
+				// this stream
 				break
 			}
 
-			completeLine = append(completeLine, lineBytes...)
+			lastLineIsPartial = eof
+			if !eof {
+				completeLine = completeLine[:0]
+			}
 		}
 
-		if eof {
+		if !eof {
+			continue
+		}
+
+		if !reader.following {
 			break
 		}
 
-		if reader.err != nil {
+		reader.readingCaughtUp.Store(true)
+		time.Sleep(followPollInterval)
+		if reader.stopped.Load() {
 			break
 		}
 
-		newLineString := string(completeLine)
-		newLine := NewLine(newLineString)
+		file, isFile := stream.(*os.File)
+		if !isFile || originalFileName == nil {
+			continue
+		}
 
-		reader.Lock()
-		if reader.replaced {
-			// Somebody called setText(), never mind reading the rest of this stream
-			reader.Unlock()
-			break
+		var restart bool
+		file, restart = reader.checkForRotation(file, *originalFileName)
+		if restart {
+			// Whatever partial line we had is done, new contents go on new
+			// lines
+			stream = file
+			closer = file
+			bufioReader.Reset(reader.newDecodingStream(file))
+			completeLine = completeLine[:0]
+			lastLineIsPartial = false
 		}
-		reader.lines = append(reader.lines, &newLine)
+	}
+
+	t1 := time.Now().UnixNano()
+	dtNanos := t1 - t0
+	log.Debug("Stream read in ", dtNanos/1_000_000, "ms")
+}
+
+// Add a line to the end of our lines, or replace the last line if
+// replaceLastLine is true.
+//
+// Returns false if our contents have been replaced using setText(), or if we
+// have been stopped, and reading should stop.
+func (reader *Reader) addLine(lineBytes []byte, replaceLastLine bool) bool {
+	newLine := lineFromBytes(lineBytes)
+
+	reader.Lock()
+	if reader.replaced || reader.stopped.Load() {
 		reader.Unlock()
-		completeLine = completeLine[:0]
+		return false
+	}
+	reader.lastLineIsPartial = !bytes.HasSuffix(lineBytes, []byte{'\n'})
+	if replaceLastLine && len(reader.lines) > 0 {
+		reader.lines[len(reader.lines)-1] = &newLine
+	} else {
+		reader.lines = append(reader.lines, &newLine)
+	}
+	reader.Unlock()
+
+	// This is how to do a non-blocking write to a channel:
+	// https://gobyexample.com/non-blocking-channel-operations
+	select {
+	case reader.moreLinesAdded <- true:
+	default:
+		// Default case required for the write to be non-blocking
+	}
 
-		// This is how to do a non-blocking write to a channel:
-		// https://gobyexample.com/non-blocking-channel-operations
+	if reader.moreLinesToHighlight != nil {
+		reader.highlightingCaughtUp.Store(false)
 		select {
-		case reader.moreLinesAdded <- true:
+		case reader.moreLinesToHighlight <- true:
 		default:
-			// Default case required for the write to be non-blocking
 		}
 	}
 
-	if onDone != nil {
-		onDone()
+	return true
+}
+
+// Create a Line from some bytes, dropping the line ending, "\n" or "\r\n",
+// just like bufio.Reader.ReadLine() does.
+func lineFromBytes(lineBytes []byte) Line {
+	if len(lineBytes) > 0 && lineBytes[len(lineBytes)-1] == '\n' {
+		drop := 1
+		if len(lineBytes) > 1 && lineBytes[len(lineBytes)-2] == '\r' {
+			drop = 2
+		}
+		lineBytes = lineBytes[:len(lineBytes)-drop]
 	}
 
-	t1 := time.Now().UnixNano()
-	dtNanos := t1 - t0
-	log.Debug("Stream read in ", dtNanos/1_000_000, "ms")
+	return NewLine(string(lineBytes))
 }
 
 // NewReaderFromStream creates a new stream reader
@@ -233,8 +500,20 @@ func (reader *Reader) readStream(stream io.Reader, originalFileName *string, fro
 //
 // If non-empty, the name will be displayed by the pager in the bottom left
 // corner to help the user keep track of what is being paged.
+//
+// Compressed streams will be transparently decompressed.
 func NewReaderFromStream(name string, reader io.Reader, style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer) *Reader {
-	mReader := newReaderFromStream(reader, nil, nil, style, formatter, lexer)
+	return NewReaderFromStreamWithOptions(name, reader, style, formatter, lexer, ReaderOptions{})
+}
+
+// NewReaderFromStreamWithOptions works like NewReaderFromStream(), but lets
+// you pass ReaderOptions, for example for setting the input encoding.
+func NewReaderFromStreamWithOptions(name string, reader io.Reader, style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer, options ReaderOptions) *Reader {
+	mReader := newReaderFromStream(&decompressingReader{source: reader}, nil, nil, style, formatter, lexer, options)
+	if formatter == nil {
+		mReader.highlightingDone.Store(true) // No highlighting to do == nothing left == Done!
+		mReader.reportMaybeDone()
+	}
 
 	if len(name) > 0 {
 		mReader.Lock()
@@ -255,8 +534,11 @@ func NewReaderFromStream(name string, reader io.Reader, style chroma.Style, form
 // If fromFilter is not nil this method will wait() for it, and effectively
 // takes over ownership for it.
 //
-// If lexer is not nil, the file will be highlighted after being fully read.
-func newReaderFromStream(reader io.Reader, originalFileName *string, fromFilter *exec.Cmd, style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer) *Reader {
+// If formatter is not nil, lines will be highlighted in batches as they are
+// read, see highlightStream(). If lexer is nil, we'll try to figure one out
+// from the contents. Without a formatter, it's up to the caller to mark
+// highlighting as done.
+func newReaderFromStream(reader io.Reader, originalFileName *string, fromFilter *exec.Cmd, style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer, options ReaderOptions) *Reader {
 	done := atomic.Bool{}
 	done.Store(false)
 	highlightingDone := atomic.Bool{}
@@ -269,23 +551,26 @@ func newReaderFromStream(reader io.Reader, originalFileName *string, fromFilter
 		maybeDone:        make(chan bool, 1),
 		highlightingDone: &highlightingDone,
 		done:             &done,
+		following:        options.Follow,
+		forcedEncoding:   options.Encoding,
+		sourceFile:       originalFileName,
+	}
+	if originalFileName == nil {
+		returnMe.rawBytes = newRawBytes()
+	}
+
+	// Must be set up before we start reading, readStream() uses it
+	if formatter != nil {
+		returnMe.moreLinesToHighlight = make(chan bool, 1)
 	}
 
 	// FIXME: Make sure that if we panic somewhere inside of this goroutine,
 	// the main program terminates and prints our panic stack trace.
-	go returnMe.readStream(reader, originalFileName, fromFilter, func() {
-		if lexer == nil {
-			return
-		}
+	go returnMe.readStream(reader, originalFileName, fromFilter)
 
-		highlightFromMemory(&returnMe, style, formatter, lexer)
-
-		returnMe.highlightingDone.Store(true)
-		select {
-		case returnMe.maybeDone <- true:
-		default:
-		}
-	})
+	if formatter != nil {
+		go returnMe.highlightStream(style, formatter, lexer)
+	}
 
 	return &returnMe
 }
@@ -314,6 +599,7 @@ func NewReaderFromText(name string, text string) *Reader {
 		lines:            lines,
 		done:             &done,
 		highlightingDone: &highlightingDone,
+		text:             &text,
 	}
 	if name != "" {
 		returnMe.name = &name
@@ -327,30 +613,101 @@ func newReaderFromCommand(filename string, filterCommand ...string) (*Reader, er
 	filterWithFilename := append(filterCommand, filename)
 	filter := exec.Command(filterWithFilename[0], filterWithFilename[1:]...)
 
-	filterOut, err := filter.StdoutPipe()
+	filterOut, filterErr, err := startFilter(filter)
 	if err != nil {
 		return nil, err
 	}
 
+	return newReaderFromFilter(filename, filter, filterOut, filterErr, chroma.Style{}, nil, nil), nil
+}
+
+// NewReaderFromShellCommand runs a shell command and reads its output.
+//
+// The command will be the name of this Reader. Reloading it using 'R' in the
+// pager runs the command again, see also Pager.ReloadInterval.
+func NewReaderFromShellCommand(command string) (*Reader, error) {
+	filter := ShellCommand(command)
+	filterOut, filterErr, err := startFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := newReaderFromFilter(command, filter, filterOut, filterErr, chroma.Style{}, nil, nil)
+	reader.Lock()
+	reader.shellCommand = command
+	reader.reopen = func() (*Reader, error) {
+		return NewReaderFromShellCommand(command)
+	}
+	reader.Unlock()
+
+	return reader, nil
+}
+
+// ShellCommand creates a command for running a command line using the system
+// shell. This is how NewReaderFromShellCommand() runs its command.
+func ShellCommand(command string) *exec.Cmd {
+	shell := []string{"sh", "-c"}
+	if runtime.GOOS == "windows" {
+		shell = []string{"cmd", "/C"}
+	}
+
+	return exec.Command(shell[0], append(shell[1:], command)...)
+}
+
+// Start a filter command, connected to pipes for reading its output. Its stderr
+// is collected in the background.
+func startFilter(filter *exec.Cmd) (stdout io.Reader, stderr *_FilterStderr, err error) {
+	filterOut, err := filter.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	filterErr, err := filter.StderrPipe()
 	if err != nil {
 		// The error stream is only used in case of failures, and having it
 		// nil is fine, so just log this and move along.
-		log.Warnf("Stderr not available from %s: %s", filterCommand[0], err.Error())
+		log.Warnf("Stderr not available from %s: %s", filter.Path, err.Error())
 	}
 
 	err = filter.Start()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	reader := newReaderFromStream(filterOut, nil, filter, chroma.Style{}, nil, nil)
-	reader.highlightingDone.Store(true) // No highlighting to do == nothing left == Done!
+	return filterOut, collectFilterStderr(filterErr), nil
+}
+
+// newReaderFromFilter creates a new reader from the output of a started filter,
+// see startFilter().
+//
+// The filter's exit status and stderr will be reported through the Reader's
+// err field. Stderr is also reported as it arrives, see errors.go.
+//
+// If formatter is nil, the output won't be highlighted.
+func newReaderFromFilter(name string, filter *exec.Cmd, filterOut io.Reader, filterErr *_FilterStderr, style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer) *Reader {
+	reader := newReaderFromStream(filterOut, nil, filter, style, formatter, lexer, ReaderOptions{})
+	if formatter == nil {
+		reader.highlightingDone.Store(true) // No highlighting to do == nothing left == Done!
+		reader.reportMaybeDone()
+	}
 	reader.Lock()
-	reader.name = &filename
+	reader.name = &name
 	reader._stderr = filterErr
 	reader.Unlock()
-	return reader, nil
+
+	filterErr.onUpdate(func(stderrText string) {
+		reader.Lock()
+		reader.filterStderr = stderrText
+		reader.Unlock()
+
+		// Get the status bar updated
+		select {
+		case reader.moreLinesAdded <- true:
+		default:
+		}
+	})
+
+	return reader
 }
 
 // Duplicate of moar/moar.go:tryOpen
@@ -438,30 +795,108 @@ func countLines(filename string) (uint64, error) {
 // apply highlighting to the file using Chroma:
 // https://github.com/alecthomas/chroma
 func NewReaderFromFilename(filename string, style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer) (*Reader, error) {
+	return NewReaderFromFilenameWithOptions(filename, style, formatter, lexer, ReaderOptions{})
+}
+
+// NewReaderFromFilenameWithOptions works like NewReaderFromFilename(), but
+// lets you pass ReaderOptions, for example for following the file.
+func NewReaderFromFilenameWithOptions(filename string, style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer, options ReaderOptions) (*Reader, error) {
+	returnMe, err := newReaderFromFilename(filename, style, formatter, lexer, options)
+	if err != nil {
+		return nil, err
+	}
+
+	returnMe.Lock()
+	returnMe.reopen = func() (*Reader, error) {
+		return NewReaderFromFilenameWithOptions(filename, style, formatter, lexer, options)
+	}
+	returnMe.Unlock()
+
+	return returnMe, nil
+}
+
+func newReaderFromFilename(filename string, style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer, options ReaderOptions) (*Reader, error) {
+	if info, err := os.Stat(filename); err == nil && info.IsDir() {
+		return newReaderFromDirectory(filename, style, formatter, options)
+	}
+
 	fileError := tryOpen(filename)
 	if fileError != nil {
 		return nil, fileError
 	}
 
-	if strings.HasSuffix(filename, ".gz") {
-		return newReaderFromCommand(filename, "gzip", "-d", "-c")
+	if options.LessOpen != "" {
+		return newReaderFromLessOpen(filename, style, formatter, lexer, options)
 	}
-	if strings.HasSuffix(filename, ".bz2") {
-		return newReaderFromCommand(filename, "bzip2", "-d", "-c")
+
+	stream, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files don't make us wait for input, so we can sniff the compression
+	// format right away
+	decompressed, format, err := decompress(stream)
+	if err != nil {
+		_ = stream.Close()
+		return nil, err
 	}
-	if strings.HasSuffix(filename, ".xz") {
-		return newReaderFromCommand(filename, "xz", "-d", "-c")
+
+	if format != nil {
+		// Make readStream() close the file when it's done with it
+		return newReaderFromCompressedFile(filename, decompressedFile{decompressed, stream}, format, style, formatter, lexer, options), nil
 	}
 
-	stream, err := os.Open(filename)
+	// Not compressed, undo the sniffing so that we can read the file as is
+	_, err = stream.Seek(0, io.SeekStart)
 	if err != nil {
+		_ = stream.Close()
 		return nil, err
 	}
 
+	fileInfo, err := stream.Stat()
+	if err != nil {
+		_ = stream.Close()
+		return nil, err
+	}
+
+	if lexer == nil {
+		lexer = lexers.Match(filename)
+	}
+	if lexer == nil {
+		// Guessing the language from the contents is for streams, which
+		// have no names to go by. Files can get a language using --lang.
+		formatter = nil
+	}
+
+	needsDecoding := fileNeedsDecoding(stream, options.Encoding)
+	if !options.Follow && !needsDecoding && fileInfo.Mode().IsRegular() && fileInfo.Size() > lazyReadingThreshold {
+		log.Debug("Reading large file lazily: ", filename)
+		return newLazyReader(stream, filename, style, formatter, lexer), nil
+	}
+
+	if options.Follow || needsDecoding || fileInfo.Size() > MAX_HIGHLIGHT_SIZE {
+		// Highlighting from the file in parallel would make us stop reading
+		// when the highlighted text arrives, see setText(). Also, we can only
+		// highlight UTF-8, and large files must be highlighted in chunks.
+		// Instead, let the stream reader highlight lines as it reads them.
+		returnMe := newReaderFromStream(stream, &filename, nil, style, formatter, lexer, options)
+		if formatter == nil {
+			returnMe.highlightingDone.Store(true) // No highlighting to do == nothing left == Done!
+			returnMe.reportMaybeDone()
+		}
+
+		returnMe.Lock()
+		returnMe.name = &filename
+		returnMe.Unlock()
+
+		return returnMe, nil
+	}
+
 	// Set lexer to nil in this call since we want to do our own highlighting in
 	// parallel with the stream being read. See the call to
 	// StartHighlightingFromFile() below.
-	returnMe := newReaderFromStream(stream, &filename, nil, chroma.Style{}, nil, nil)
+	returnMe := newReaderFromStream(stream, &filename, nil, chroma.Style{}, nil, nil, options)
 
 	returnMe.Lock()
 	returnMe.name = &filename
@@ -472,13 +907,37 @@ func NewReaderFromFilename(filename string, style chroma.Style, formatter chroma
 	return returnMe, nil
 }
 
+func newReaderFromCompressedFile(filename string, decompressed io.Reader, format *compressionFormat, style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer, options ReaderOptions) *Reader {
+	if lexer == nil {
+		lexer = lexers.Match(format.stripSuffix(filename))
+	}
+	if lexer == nil {
+		// Just like for uncompressed files, see newReaderFromFilename()
+		formatter = nil
+	}
+
+	// We can't follow compressed files, and we can't count their lines up
+	// front, so no originalFileName here
+	options.Follow = false
+	returnMe := newReaderFromStream(decompressed, nil, nil, style, formatter, lexer, options)
+	if formatter == nil {
+		returnMe.highlightingDone.Store(true) // No highlighting to do == nothing left == Done!
+		returnMe.reportMaybeDone()
+	}
+
+	returnMe.Lock()
+	returnMe.name = &filename
+	returnMe.Unlock()
+
+	log.Debug(format.name, " decompressing ", filename)
+
+	return returnMe
+}
+
 func startHighlightingFromFile(reader *Reader, filename string, style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer) {
 	reportDone := func() {
 		reader.highlightingDone.Store(true)
-		select {
-		case reader.maybeDone <- true:
-		default:
-		}
+		reader.reportMaybeDone()
 
 		log.Trace("Highlighting done")
 	}
@@ -524,51 +983,154 @@ func startHighlightingFromFile(reader *Reader, filename string, style chroma.Sty
 	}()
 }
 
-func highlightFromMemory(reader *Reader, style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer) {
+// Highlight lines as they are read, in chunks of highlightChunkLines lines.
+// We keep going until reading is done.
+//
+// Since each chunk is highlighted separately, constructs spanning chunk borders
+// (like long comments) may get the wrong colors. That's the price we pay for
+// showing colors before all input has arrived, and for not highlighting large
+// inputs all at once.
+//
+// Chunk borders depend only on line numbers, not on how fast the lines
+// arrive. A chunk that is still incomplete is highlighted as far as we have
+// it, and then highlighted again from its start as more lines arrive. This way
+// the final colors are always the same for the same input.
+func (reader *Reader) highlightStream(style chroma.Style, formatter chroma.Formatter, lexer chroma.Lexer) {
 	defer func() {
 		reader.highlightingDone.Store(true)
-		select {
-		case reader.maybeDone <- true:
-		default:
-		}
+		reader.reportMaybeDone()
 	}()
 
 	if lexer == nil {
-		return
+		lexer = reader.detectStreamLexer()
+		if lexer == nil {
+			log.Debug("No language detected, not highlighting")
+			return
+		}
 	}
 
-	var byteCount int64
-	reader.Lock()
-	for _, line := range reader.lines {
-		byteCount += int64(len(line.raw))
+	t0 := time.Now().UnixNano()
+
+	// Where the current chunk starts, and its lines both before highlighting
+	// and as they are currently shown
+	chunkStart := 0
+	var chunkOriginals []*Line
+	var chunkShown []*Line
+
+	for {
+		// Check this before getting the lines, so that if we're done we know
+		// we got all of them
+		done := reader.done.Load()
+
+		// Lines may be added while we're highlighting, so we work on a copy
+		reader.Lock()
+		firstNew := chunkStart + len(chunkOriginals)
+		lastLine := len(reader.lines)
+		if !done && reader.lastLineIsPartial && lastLine > firstNew {
+			// More text may be added to this line, wait with it until we know
+			// more
+			lastLine--
+		}
+		newLines := make([]*Line, lastLine-firstNew)
+		copy(newLines, reader.lines[firstNew:lastLine])
+		reader.Unlock()
+
+		for len(newLines) > 0 {
+			take := highlightChunkLines - len(chunkOriginals)
+			if take > len(newLines) {
+				take = len(newLines)
+			}
+			chunkOriginals = append(chunkOriginals, newLines[:take]...)
+			chunkShown = append(chunkShown, newLines[:take]...)
+			newLines = newLines[take:]
+
+			highlighted := highlightLines(chunkOriginals, style, formatter, lexer)
+			if highlighted != nil {
+				if !reader.replaceLines(chunkStart, chunkShown, highlighted) {
+					// Somebody else replaced our lines, never mind the rest
+					return
+				}
+				chunkShown = highlighted
+			}
+
+			if len(chunkOriginals) == highlightChunkLines {
+				chunkStart += highlightChunkLines
+				chunkOriginals = nil
+				chunkShown = nil
+			}
+		}
+
+		if done {
+			break
+		}
+
+		reader.waitForMoreLinesToHighlight()
 	}
-	reader.Unlock()
 
-	if byteCount > MAX_HIGHLIGHT_SIZE {
-		log.Debug("File too large for highlighting: ", byteCount)
-		return
+	t1 := time.Now().UnixNano()
+	log.Debug("Highlighted ", chunkStart+len(chunkOriginals), " lines in ", (t1-t0)/1_000_000, "ms")
+}
+
+// Until more lines arrive, we have highlighted everything there is. That matters
+// when following, see isCaughtUp().
+func (reader *Reader) waitForMoreLinesToHighlight() {
+	reader.highlightingCaughtUp.Store(true)
+	<-reader.moreLinesToHighlight
+	reader.highlightingCaughtUp.Store(false)
+}
+
+// Wait until we have enough input to say what language it is, then figure
+// that out. Returns nil if we couldn't tell.
+func (reader *Reader) detectStreamLexer() chroma.Lexer {
+	start := []byte{}
+	for {
+		done := reader.done.Load()
+
+		start = start[:0]
+		reader.Lock()
+		for _, line := range reader.lines {
+			if len(start) >= encodingSniffSize {
+				break
+			}
+			start = append(start, line.raw...)
+			start = append(start, '\n')
+		}
+		reader.Unlock()
+
+		if done || len(start) >= encodingSniffSize {
+			break
+		}
+
+		reader.waitForMoreLinesToHighlight()
 	}
 
-	textBuilder := strings.Builder{}
+	return reader.detectLexer(start)
+}
+
+// Replace the lines starting at firstIndex with new ones. Lines that have
+// changed since we got them won't be replaced.
+//
+// Returns false if our contents have been replaced using setText().
+func (reader *Reader) replaceLines(firstIndex int, oldLines []*Line, newLines []*Line) bool {
 	reader.Lock()
-	for _, line := range reader.lines {
-		textBuilder.WriteString(line.raw)
-		textBuilder.WriteString("\n")
+	if reader.replaced || reader.stopped.Load() {
+		reader.Unlock()
+		return false
 	}
-	reader.Unlock()
-
-	highlighted, err := highlight(textBuilder.String(), style, formatter, lexer)
-	if err != nil {
-		log.Warn("Highlighting failed: ", err)
-		return
+	for i, newLine := range newLines {
+		index := firstIndex + i
+		if index < len(reader.lines) && reader.lines[index] == oldLines[i] {
+			reader.lines[index] = newLine
+		}
 	}
+	reader.Unlock()
 
-	if highlighted == nil {
-		// No highlighting would be done, never mind
-		return
+	select {
+	case reader.moreLinesAdded <- true:
+	default:
 	}
 
-	reader.setText(*highlighted)
+	return true
 }
 
 // createStatusUnlocked() assumes that its caller is holding the lock
@@ -578,20 +1140,36 @@ func (reader *Reader) createStatusUnlocked(lastLineOneBased int) string {
 		prefix = path.Base(*reader.name) + ": "
 	}
 
-	if len(reader.lines) == 0 {
-		return prefix + "<empty>"
+	suffix := ""
+	if reader.hexDumpOf != nil {
+		suffix += "  hex"
+	}
+	if reader.detectedLanguage != "" {
+		suffix += "  " + reader.detectedLanguage
+	}
+	if reader.encodingName != "" {
+		suffix += "  " + reader.encodingName
+	}
+	if reopened := reader.createReopenedStatusUnlocked(); reopened != "" {
+		suffix += "  " + reopened
+	}
+
+	lineCount := reader.getLineCountUnlocked()
+	if lineCount == 0 {
+		return prefix + "<empty>" + suffix
 	}
 
-	if len(reader.lines) == 1 {
-		return prefix + "1 line  100%"
+	if lineCount == 1 {
+		return prefix + "1 line  100%" + suffix
 	}
 
-	percent := int(100 * float64(lastLineOneBased) / float64(len(reader.lines)))
+	percent := int(100 * float64(lastLineOneBased) / float64(lineCount))
 
-	return fmt.Sprintf("%s%s lines  %d%%",
+	return fmt.Sprintf("%s%s lines  %d%%%s",
 		prefix,
-		formatNumber(uint(len(reader.lines))),
-		percent)
+		formatNumber(uint(lineCount)),
+		percent,
+		suffix)
 }
 
 // GetLineCount returns the number of lines available for viewing
@@ -599,6 +1177,14 @@ func (reader *Reader) GetLineCount() int {
 	reader.Lock()
 	defer reader.Unlock()
 
+	return reader.getLineCountUnlocked()
+}
+
+func (reader *Reader) getLineCountUnlocked() int {
+	if reader.lazy != nil {
+		return reader.lazy.lineCount
+	}
+
 	return len(reader.lines)
 }
 
@@ -610,9 +1196,12 @@ func (reader *Reader) GetLine(lineNumberOneBased int) *Line {
 	if lineNumberOneBased < 1 {
 		return nil
 	}
-	if lineNumberOneBased > len(reader.lines) {
+	if lineNumberOneBased > reader.getLineCountUnlocked() {
 		return nil
 	}
+	if reader.lazy != nil {
+		return reader.lazy.getLine(lineNumberOneBased - 1)
+	}
 	return reader.lines[lineNumberOneBased-1]
 }
 
@@ -645,7 +1234,8 @@ func (reader *Reader) getLinesUnlocked(firstLineOneBased int, wantedLineCount in
 		firstLineOneBased = 1
 	}
 
-	if len(reader.lines) == 0 || wantedLineCount == 0 {
+	lineCount := reader.getLineCountUnlocked()
+	if lineCount == 0 || wantedLineCount == 0 {
 		return &InputLines{
 				lines:             nil,
 				firstLineOneBased: firstLineOneBased,
@@ -657,8 +1247,8 @@ func (reader *Reader) getLinesUnlocked(firstLineOneBased int, wantedLineCount in
 	firstLineZeroBased := firstLineOneBased - 1
 	lastLineZeroBased := nonWrappingAdd(firstLineZeroBased, wantedLineCount-1)
 
-	if lastLineZeroBased >= len(reader.lines) {
-		lastLineZeroBased = len(reader.lines) - 1
+	if lastLineZeroBased >= lineCount {
+		lastLineZeroBased = lineCount - 1
 	}
 
 	// Prevent reading past the end of the available lines
@@ -673,9 +1263,18 @@ func (reader *Reader) getLinesUnlocked(firstLineOneBased int, wantedLineCount in
 		return reader.getLinesUnlocked(firstLineOneBased, wantedLineCount)
 	}
 
-	returnLines := reader.lines[firstLineZeroBased : lastLineZeroBased+1]
+	var returnLines []*Line
+	if reader.lazy != nil {
+		returnLines = make([]*Line, 0, lastLineZeroBased-firstLineZeroBased+1)
+		for i := firstLineZeroBased; i <= lastLineZeroBased; i++ {
+			returnLines = append(returnLines, reader.lazy.getLine(i))
+		}
+	} else {
+		returnLines = reader.lines[firstLineZeroBased : lastLineZeroBased+1]
+	}
+
 	overflow := didFit
-	if len(returnLines) != len(reader.lines) {
+	if len(returnLines) != lineCount {
 		overflow = didOverflow // We're not returning all available lines
 	}
 
@@ -687,8 +1286,17 @@ func (reader *Reader) getLinesUnlocked(firstLineOneBased int, wantedLineCount in
 		overflow
 }
 
-// Replace reader contents with the given text and mark as done
-func (reader *Reader) setText(text string) {
+// GetLineRange is part of the LineSource interface
+func (reader *Reader) GetLineRange(firstLineOneBased int, wantedLineCount int) *LineRange {
+	lines, _ := reader.GetLines(firstLineOneBased, wantedLineCount)
+	return &LineRange{
+		Lines:             lines.lines,
+		FirstLineOneBased: lines.firstLineOneBased,
+		StatusText:        lines.statusText,
+	}
+}
+
+func linesFromText(text string) []*Line {
 	lines := []*Line{}
 	for _, lineString := range strings.Split(text, "\n") {
 		line := NewLine(lineString)
@@ -701,16 +1309,20 @@ func (reader *Reader) setText(text string) {
 		lines = lines[0 : len(lines)-1]
 	}
 
+	return lines
+}
+
+// Replace reader contents with the given text and mark as done
+func (reader *Reader) setText(text string) {
+	lines := linesFromText(text)
+
 	reader.Lock()
 	reader.lines = lines
 	reader.replaced = true
 	reader.Unlock()
 
 	reader.done.Store(true)
-	select {
-	case reader.maybeDone <- true:
-	default:
-	}
+	reader.reportMaybeDone()
 	log.Trace("Reader done, contents explicitly set")
 
 	select {
@@ -1,6 +1,7 @@
 package m
 
 import (
+	"io"
 	"math"
 	"os"
 	"os/exec"
@@ -8,10 +9,15 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/alecthomas/chroma/v2"
 	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/lexers"
 	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/klauspost/compress/zstd"
 	"gotest.tools/v3/assert"
 )
 
@@ -155,22 +161,6 @@ func (r *Reader) _wait() error {
 
 func TestGetLines(t *testing.T) {
 	for _, file := range getTestFiles() {
-		if strings.HasSuffix(file, ".xz") {
-			_, err := exec.LookPath("xz")
-			if err != nil {
-				t.Log("Not testing xz compressed file, xz not found in $PATH: ", file)
-				continue
-			}
-		}
-
-		if strings.HasSuffix(file, ".bz2") {
-			_, err := exec.LookPath("bzip2")
-			if err != nil {
-				t.Log("Not testing bzip2 compressed file, bzip2 not found in $PATH: ", file)
-				continue
-			}
-		}
-
 		reader, err := NewReaderFromFilename(file, *styles.Get("native"), formatters.TTY16m, nil)
 		if err != nil {
 			t.Errorf("Error opening file <%s>: %s", file, err.Error())
@@ -200,6 +190,15 @@ func testHighlightingLineCount(t *testing.T, filenameWithPath string) {
 	if strings.HasSuffix(filenameWithPath, ".gz") {
 		return
 	}
+	if strings.HasSuffix(filenameWithPath, ".zst") {
+		return
+	}
+	if strings.HasSuffix(filenameWithPath, ".lz4") {
+		return
+	}
+	if strings.HasSuffix(filenameWithPath, ".Z") {
+		return
+	}
 
 	// Load the unformatted file
 	rawBytes, err := os.ReadFile(filenameWithPath)
@@ -311,22 +310,319 @@ func testCompressedFile(t *testing.T, filename string) {
 
 func TestCompressedFiles(t *testing.T) {
 	testCompressedFile(t, "compressed.txt.gz")
+	testCompressedFile(t, "compressed.txt.bz2")
+	testCompressedFile(t, "compressed.txt.xz")
+	testCompressedFile(t, "compressed.txt.zst")
+	testCompressedFile(t, "compressed.txt.lz4")
+	testCompressedFile(t, "compressed.txt.Z")
+}
+
+func TestCompressedStreams(t *testing.T) {
+	for _, filename := range []string{"compressed.txt.gz", "compressed.txt.bz2", "compressed.txt.xz", "compressed.txt.zst", "compressed.txt.lz4", "compressed.txt.Z"} {
+		file, err := os.Open(getSamplesDir() + "/" + filename)
+		assert.NilError(t, err)
+
+		reader := NewReaderFromStream("", file, *styles.Get("native"), formatters.TTY16m, nil)
+		assert.NilError(t, reader._wait())
+		assert.NilError(t, file.Close())
+
+		lines, _ := reader.GetLines(1, 5)
+		assert.Equal(t, lines.lines[0].Plain(nil), "This is a compressed file", "%s", filename)
+	}
+}
+
+// Zstd decoders have goroutines that must be stopped after use
+func TestZstdDecoderClosed(t *testing.T) {
+	file, err := os.Open(getSamplesDir() + "/compressed.txt.zst")
+	assert.NilError(t, err)
+	defer file.Close()
+
+	stream := &decompressingReader{source: file}
+	decompressed, err := io.ReadAll(stream)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.HasPrefix(string(decompressed), "This is a compressed file"))
+
+	assert.NilError(t, stream.Close())
+	_, err = stream.Read(make([]byte, 1))
+	assert.Equal(t, err, zstd.ErrDecoderClosed)
+}
+
+// Compression should be detected by contents, not by file name
+func TestMisnamedCompressedFile(t *testing.T) {
+	compressed, err := os.ReadFile(getSamplesDir() + "/compressed.txt.gz")
+	assert.NilError(t, err)
+
+	misnamed := t.TempDir() + "/compressed.txt"
+	assert.NilError(t, os.WriteFile(misnamed, compressed, 0o600))
+
+	reader, err := NewReaderFromFilename(misnamed, *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	lines, _ := reader.GetLines(1, 5)
+	assert.Equal(t, lines.lines[0].Plain(nil), "This is a compressed file")
+}
+
+// Text files starting with "BZh" are not bzip2 compressed
+func TestBzip2LookalikeFile(t *testing.T) {
+	filename := t.TempDir() + "/bzh.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte("BZh9 is how bzip2 files start\n"), 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	lines, _ := reader.GetLines(1, 5)
+	assert.Equal(t, lines.lines[0].Plain(nil), "BZh9 is how bzip2 files start")
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed atomic.Bool
+}
+
+func (recorder *closeRecorder) Close() error {
+	recorder.closed.Store(true)
+	return nil
+}
+
+// Compressed files should be closed when we're done decompressing them
+func TestStreamClosedWhenRead(t *testing.T) {
+	stream := &closeRecorder{Reader: strings.NewReader("hello\n")}
+	reader := newReaderFromStream(stream, nil, nil, chroma.Style{}, nil, nil, ReaderOptions{})
+	reader.highlightingDone.Store(true)
+	assert.NilError(t, reader._wait())
+
+	// _wait() returns when the last line is in, closing happens after that
+	for i := 0; i < 100 && !stream.closed.Load(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Assert(t, stream.closed.Load())
+}
+
+// Text that only starts like some compression magic must still be shown as is
+func TestAlmostCompressedStream(t *testing.T) {
+	reader := NewReaderFromStream("", strings.NewReader("BZ\nBZip"), *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, reader._wait())
+
+	lines, _ := reader.GetLines(1, 5)
+	assert.Equal(t, len(lines.lines), 2)
+	assert.Equal(t, lines.lines[0].Plain(nil), "BZ")
+	assert.Equal(t, lines.lines[1].Plain(nil), "BZip")
+}
+
+// Wait for the reader to have the given number of lines, or fail the test
+func waitForLineCount(t *testing.T, reader *Reader, lineCount int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for reader.GetLineCount() != lineCount {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d lines, still have %d", lineCount, reader.GetLineCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFollowFile(t *testing.T) {
+	filename := t.TempDir() + "/growing.txt"
+	err := os.WriteFile(filename, []byte("first\nsecond"), 0o600)
+	assert.NilError(t, err)
+
+	reader, err := NewReaderFromFilenameWithOptions(filename, *styles.Get("native"), formatters.TTY16m, nil, ReaderOptions{Follow: true})
+	assert.NilError(t, err)
+	waitForLineCount(t, reader, 2)
+
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0)
+	assert.NilError(t, err)
+	_, err = file.WriteString(" continued\nthird\n")
+	assert.NilError(t, err)
+	assert.NilError(t, file.Close())
+
+	waitForLineCount(t, reader, 3)
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "first")
+	assert.Equal(t, reader.GetLine(2).Plain(nil), "second continued")
+	assert.Equal(t, reader.GetLine(3).Plain(nil), "third")
+
+	// Following never ends
+	assert.Assert(t, !reader.done.Load())
+}
+
+// Idle followed files aren't done, but the pager shouldn't say they're loading
+func TestFollowCaughtUp(t *testing.T) {
+	filename := t.TempDir() + "/caughtup.go"
+	assert.NilError(t, os.WriteFile(filename, []byte("package main\n"), 0o600))
+
+	reader, err := NewReaderFromFilenameWithOptions(filename, *styles.Get("native"), formatters.TTY16m, nil, ReaderOptions{Follow: true})
+	assert.NilError(t, err)
+	waitForCaughtUp(t, reader)
+	waitForHighlighting(t, reader, 1)
+
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0)
+	assert.NilError(t, err)
+	_, err = file.WriteString("// More\n")
+	assert.NilError(t, err)
+	assert.NilError(t, file.Close())
+
+	waitForLineCount(t, reader, 2)
+	waitForCaughtUp(t, reader)
+	assert.Assert(t, !reader.done.Load())
+}
+
+func waitForCaughtUp(t *testing.T, reader *Reader) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !reader.isCaughtUp() {
+		if time.Now().After(deadline) {
+			t.Fatal("Reader never caught up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func waitForHighlighting(t *testing.T, reader *Reader, lineNumberOneBased int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(reader.GetLine(lineNumberOneBased).raw, "\x1b[") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Line %d never got highlighted: %q", lineNumberOneBased, reader.GetLine(lineNumberOneBased).raw)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHighlightStreamIncrementally(t *testing.T) {
+	pipeReader, pipeWriter := io.Pipe()
+	reader := NewReaderFromStream("", pipeReader, *styles.Get("native"), formatters.TTY16m, lexers.Get("go"))
+
+	_, err := pipeWriter.Write([]byte("package main\n// A comment\n"))
+	assert.NilError(t, err)
+
+	// Highlighting should happen while the stream is still open
+	waitForLineCount(t, reader, 2)
+	waitForHighlighting(t, reader, 1)
+	waitForHighlighting(t, reader, 2)
+	assert.Assert(t, !reader.highlightingDone.Load())
 
-	_, err := exec.LookPath("bzip2")
-	if err == nil {
-		testCompressedFile(t, "compressed.txt.bz2")
-	} else {
-		t.Log("WARNING: bzip2 not found in path, not testing automatic bzip2 decompression")
+	_, err = pipeWriter.Write([]byte("package more\n"))
+	assert.NilError(t, err)
+	assert.NilError(t, pipeWriter.Close())
+	assert.NilError(t, reader._wait())
+
+	assert.Equal(t, reader.GetLineCount(), 3)
+	assert.Assert(t, strings.Contains(reader.GetLine(3).raw, "\x1b["))
+	assert.Equal(t, reader.GetLine(3).Plain(nil), "package more")
+}
+
+// The colors shouldn't depend on how fast the input arrives
+func TestHighlightStreamChunks(t *testing.T) {
+	defer func(lines int) { highlightChunkLines = lines }(highlightChunkLines)
+	highlightChunkLines = 3
+
+	input := []string{"/* A comment", "still commenting", "*/", "package main", "/* Another", "comment */"}
+
+	allAtOnce := NewReaderFromStream("", strings.NewReader(strings.Join(input, "\n")+"\n"), *styles.Get("native"), formatters.TTY16m, lexers.Get("go"))
+	assert.NilError(t, allAtOnce._wait())
+
+	pipeReader, pipeWriter := io.Pipe()
+	oneByOne := NewReaderFromStream("", pipeReader, *styles.Get("native"), formatters.TTY16m, lexers.Get("go"))
+	for i, line := range input {
+		_, err := pipeWriter.Write([]byte(line + "\n"))
+		assert.NilError(t, err)
+		waitForLineCount(t, oneByOne, i+1)
+		waitForHighlighting(t, oneByOne, i+1)
 	}
+	assert.NilError(t, pipeWriter.Close())
+	assert.NilError(t, oneByOne._wait())
 
-	_, err = exec.LookPath("xz")
-	if err == nil {
-		testCompressedFile(t, "compressed.txt.xz")
-	} else {
-		t.Log("WARNING: xz not found in path, not testing automatic xz decompression")
+	for lineNumber := 1; lineNumber <= len(input); lineNumber++ {
+		assert.Equal(t, oneByOne.GetLine(lineNumber).raw, allAtOnce.GetLine(lineNumber).raw, "Line %d", lineNumber)
 	}
 }
 
+func TestHighlightFollowedFile(t *testing.T) {
+	filename := t.TempDir() + "/growing.go"
+	err := os.WriteFile(filename, []byte("package main\n// Partial"), 0o600)
+	assert.NilError(t, err)
+
+	reader, err := NewReaderFromFilenameWithOptions(filename, *styles.Get("native"), formatters.TTY16m, nil, ReaderOptions{Follow: true})
+	assert.NilError(t, err)
+	waitForLineCount(t, reader, 2)
+	waitForHighlighting(t, reader, 1)
+
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0)
+	assert.NilError(t, err)
+	_, err = file.WriteString(" comment\n")
+	assert.NilError(t, err)
+	assert.NilError(t, file.Close())
+
+	// The partial line should get highlighted once it's complete
+	waitForHighlighting(t, reader, 2)
+	assert.Equal(t, reader.GetLine(2).Plain(nil), "// Partial comment")
+}
+
+func TestFollowRotatedFile(t *testing.T) {
+	filename := t.TempDir() + "/rotated.log"
+	err := os.WriteFile(filename, []byte("old\n"), 0o600)
+	assert.NilError(t, err)
+
+	reader, err := NewReaderFromFilenameWithOptions(filename, *styles.Get("native"), formatters.TTY16m, nil, ReaderOptions{Follow: true})
+	assert.NilError(t, err)
+	waitForLineCount(t, reader, 1)
+
+	assert.NilError(t, os.Rename(filename, filename+".1"))
+	err = os.WriteFile(filename, []byte("new\n"), 0o600)
+	assert.NilError(t, err)
+
+	waitForLineCount(t, reader, 2)
+	assert.Equal(t, reader.GetLine(1).Plain(nil), "old")
+	assert.Equal(t, reader.GetLine(2).Plain(nil), "new")
+
+	reader.Lock()
+	status := reader.createStatusUnlocked(2)
+	reader.Unlock()
+	assert.Assert(t, strings.Contains(status, "rotated"), status)
+}
+
+func TestFollowTruncatedFile(t *testing.T) {
+	filename := t.TempDir() + "/truncated.log"
+	err := os.WriteFile(filename, []byte("first\nsecond\n"), 0o600)
+	assert.NilError(t, err)
+
+	reader, err := NewReaderFromFilenameWithOptions(filename, *styles.Get("native"), formatters.TTY16m, nil, ReaderOptions{Follow: true})
+	assert.NilError(t, err)
+	waitForLineCount(t, reader, 2)
+
+	// Overwrite in place, this keeps the inode
+	err = os.WriteFile(filename, []byte("x\n"), 0o600)
+	assert.NilError(t, err)
+
+	waitForLineCount(t, reader, 3)
+	assert.Equal(t, reader.GetLine(3).Plain(nil), "x")
+
+	reader.Lock()
+	status := reader.createStatusUnlocked(3)
+	reader.Unlock()
+	assert.Assert(t, strings.Contains(status, "truncated"), status)
+}
+
+func TestHighlightLargeFile(t *testing.T) {
+	// Alternating styles, so that every line gets its own color codes
+	lines := "package main\n// A comment that is long enough to make this file large\n"
+	repeats := int(MAX_HIGHLIGHT_SIZE)/len(lines)*3/2 + 1
+	filename := t.TempDir() + "/large.go"
+	assert.NilError(t, os.WriteFile(filename, []byte(strings.Repeat(lines, repeats)), 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	// All chunks should have been highlighted, without changing the line count
+	lineCount := repeats * 2
+	assert.Equal(t, reader.GetLineCount(), lineCount)
+	for _, lineNumber := range []int{1, lineCount / 2, lineCount} {
+		highlighted := reader.GetLine(lineNumber)
+		assert.Assert(t, strings.Contains(highlighted.raw, "\x1b["), "Line %d: %q", lineNumber, highlighted.raw)
+	}
+	assert.Equal(t, reader.GetLine(lineCount).Plain(nil), "// A comment that is long enough to make this file large")
+}
+
 func TestFilterNotInstalled(t *testing.T) {
 	t.Skip("FIXME: Test what happens if we try to use a filter that is not installed")
 }
@@ -0,0 +1,186 @@
+package m
+
+import (
+	"fmt"
+	"math"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A reload in progress. When the new Reader is done, we tell the user how the
+// line count changed.
+type _Reload struct {
+	reader       *Reader
+	oldLineCount int
+
+	// If set, we're running a shell command again, and keep showing its
+	// previous output until the new run is done. See watch.go.
+	previousRun *Reader
+
+	// Don't tell the user when done. Used when reloading periodically.
+	quiet bool
+}
+
+// Read the current file again from disk, keeping our position in it. Shell
+// commands are run again.
+func (p *Pager) reload() {
+	p.startReload(false)
+}
+
+func (p *Pager) startReload(quiet bool) {
+	if p.isShowingHelp {
+		return
+	}
+
+	if p.reloading != nil && p.reloading.previousRun != nil {
+		if !quiet {
+			p.setStatusMessage("Still running: " + p.reloading.previousRun.shellCommand)
+		}
+		return
+	}
+
+	oldReader := asReader(p.reader)
+	if oldReader == nil {
+		p.setStatusMessage("Only files and commands can be reloaded")
+		return
+	}
+	if oldReader.hexDumpOf != nil {
+		oldReader = oldReader.hexDumpOf
+	}
+
+	oldReader.Lock()
+	reopen := oldReader.reopen
+	rerun := oldReader.shellCommand != ""
+	oldReader.Unlock()
+	if reopen == nil {
+		p.setStatusMessage("Only files and commands can be reloaded")
+		return
+	}
+
+	newReader, err := reopen()
+	if err != nil {
+		log.Info("Reload failed: ", err)
+		p.setStatusMessage("Reload failed: " + err.Error())
+		return
+	}
+	log.Debug("Reloading ", *newReader.name)
+
+	// Backspace should still take us back to where we came from
+	oldReader.Lock()
+	openedFrom := oldReader.openedFrom
+	oldReader.Unlock()
+	newReader.Lock()
+	newReader.openedFrom = openedFrom
+	newReader.Unlock()
+
+	p.reloading = &_Reload{
+		reader:       newReader,
+		oldLineCount: oldReader.GetLineCount(),
+		quiet:        quiet,
+	}
+	p.own(newReader)
+	p.watchReader(newReader)
+
+	// Stay in the view the user is in, even if the new contents look binary
+	if p.hexViewChecked == nil {
+		p.hexViewChecked = map[*Reader]bool{}
+	}
+	p.hexViewChecked[newReader] = true
+
+	if rerun {
+		// Keep showing the old output until the new one is complete, see
+		// finishRerun()
+		p.reloading.previousRun = oldReader
+		return
+	}
+
+	// The new Reader starts out empty, so we can't just keep our scroll
+	// position. Instead, scroll to where we were as the lines come in. If we
+	// were following the end of the file, keep doing that.
+	if p.TargetLineNumberOneBased != math.MaxInt {
+		p.TargetLineNumberOneBased = p.lineNumberOneBased()
+	}
+
+	p.replaceReader(oldReader, newReader)
+}
+
+// Show newReader wherever we showed oldReader, then stop oldReader.
+//
+// For shell commands, oldReader is kept around for showing what changed, see
+// finishRerun(). Stopping it just means it won't change any more.
+func (p *Pager) replaceReader(oldReader *Reader, newReader *Reader) {
+	delete(p.hexViewChecked, oldReader)
+	delete(p.viewPositions, oldReader)
+	delete(p.viewPositions, oldReader.hexDump)
+
+	replacement := func(source LineSource) LineSource {
+		if source == oldReader {
+			return newReader
+		}
+
+		reader := asReader(source)
+		if reader == nil || reader.hexDumpOf != oldReader {
+			// Not ours, leave it alone
+			return source
+		}
+
+		// Stay in the hex view
+		hexDump, created := newReader.getHexDump()
+		if hexDump == nil {
+			return newReader
+		}
+		if created {
+			p.watchReader(hexDump)
+		}
+		return hexDump
+	}
+
+	p.reader = replacement(p.reader)
+	if p.preHelpState != nil {
+		p.preHelpState.reader = replacement(p.preHelpState.reader)
+	}
+	for i := range p.files {
+		p.files[i].reader = replacement(p.files[i].reader)
+	}
+	p.replaceInPositions(oldReader, newReader)
+
+	oldReader.stop()
+	oldReader.runLessClose()
+}
+
+// If a reload just finished, tell the user what changed
+func (p *Pager) maybeReportReload() {
+	if p.reloading == nil || !p.reloading.reader.done.Load() {
+		return
+	}
+
+	reloading := p.reloading
+	p.reloading = nil
+	if reloading.previousRun != nil {
+		p.finishRerun(reloading.previousRun, reloading.reader)
+	}
+
+	if reloading.quiet {
+		return
+	}
+
+	delta := reloading.reader.GetLineCount() - reloading.oldLineCount
+
+	switch {
+	case delta > 0:
+		p.setStatusMessage(fmt.Sprintf("Reloaded, %s added", formatLineCount(delta)))
+	case delta < 0:
+		p.setStatusMessage(fmt.Sprintf("Reloaded, %s removed", formatLineCount(-delta)))
+	default:
+		p.setStatusMessage("Reloaded, same number of lines")
+	}
+}
+
+// "1 line" or "1_234 lines"
+func formatLineCount(count int) string {
+	if count == 1 {
+		return "1 line"
+	}
+
+	return formatNumber(uint(count)) + " lines"
+}
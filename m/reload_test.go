@@ -0,0 +1,115 @@
+package m
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func TestReload(t *testing.T) {
+	filename := t.TempDir() + "/report.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte(strings.Repeat("before\n", 30)), 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+	pager.scrollPosition = NewScrollPositionFromLineNumberOneBased(5, "TestReload")
+	pager.leftColumnZeroBased = 3
+	pager.searchPattern = toPattern("after")
+
+	assert.NilError(t, os.WriteFile(filename, []byte(strings.Repeat("after\n", 35)), 0o600))
+	pager.onRune('R')
+	assert.Assert(t, pager.reader != reader)
+	assert.Equal(t, pager.files[0].reader, pager.reader)
+	assert.NilError(t, pager.reader.(*Reader)._wait())
+
+	assert.Equal(t, pager.reader.GetLine(1).Plain(nil), "after")
+	assert.Equal(t, pager.TargetLineNumberOneBased, 5)
+	assert.Equal(t, pager.leftColumnZeroBased, 3)
+	assert.Equal(t, pager.searchPattern.String(), toPattern("after").String())
+	assert.Assert(t, reader.stopped.Load())
+
+	pager.maybeReportReload()
+	assert.Equal(t, pager.getStatusMessage(), "Reloaded, 5 lines added")
+	assert.Assert(t, pager.reloading == nil)
+
+	// Reload again with fewer lines
+	assert.NilError(t, os.WriteFile(filename, []byte("after\n"), 0o600))
+	pager.onRune('R')
+	assert.NilError(t, pager.reader.(*Reader)._wait())
+	pager.maybeReportReload()
+	assert.Equal(t, pager.getStatusMessage(), "Reloaded, 34 lines removed")
+}
+
+// The old Reader shouldn't keep following the file after we reload it
+func TestReloadStopsOldReader(t *testing.T) {
+	filename := t.TempDir() + "/log.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte("before\n"), 0o600))
+
+	reader, err := NewReaderFromFilenameWithOptions(filename, *styles.Get("native"), formatters.TTY16m, nil, ReaderOptions{Follow: true})
+	assert.NilError(t, err)
+	deadline := time.Now().Add(5 * time.Second)
+	for reader.GetLineCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+	pager.onRune('R')
+
+	// Appending to the file shouldn't reach the old reader
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0o600)
+	assert.NilError(t, err)
+	_, err = file.WriteString("after\n")
+	assert.NilError(t, err)
+	assert.NilError(t, file.Close())
+
+	// Stopping should make the old reader's follow loop end
+	deadline = time.Now().Add(5 * time.Second)
+	for !reader.done.Load() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Assert(t, reader.done.Load())
+	assert.Equal(t, reader.GetLineCount(), 1)
+}
+
+func TestReloadHexView(t *testing.T) {
+	filename := t.TempDir() + "/data.bin"
+	assert.NilError(t, os.WriteFile(filename, []byte("hello"), 0o600))
+
+	reader, err := NewReaderFromFilename(filename, *styles.Get("native"), formatters.TTY16m, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+	pager.onRune('x')
+	assert.Equal(t, pager.reader.(*Reader).hexDumpOf, reader)
+
+	// Reloading should keep us in the hex view
+	assert.NilError(t, os.WriteFile(filename, []byte("hej"), 0o600))
+	pager.onRune('R')
+	assert.Assert(t, pager.reader.(*Reader).hexDumpOf != nil)
+	assert.Assert(t, pager.reader.(*Reader).hexDumpOf != reader)
+	assert.NilError(t, pager.reader.(*Reader)._wait())
+	assert.Equal(t, pager.reader.GetLine(1).Plain(nil), "00000000  68 65 6a                                          |hej|")
+}
+
+func TestReloadText(t *testing.T) {
+	reader := NewReaderFromText("text", "hello")
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+
+	pager.onRune('R')
+	assert.Equal(t, pager.reader, reader)
+	assert.Equal(t, pager.getStatusMessage(), "Only files and commands can be reloaded")
+}
@@ -62,17 +62,35 @@ func (p *Pager) redraw(spinner string) overflowState {
 		p.addSearchFooter()
 
 	case _NotFound:
-		p.setFooter("Not found: " + p.searchString)
+		p.setFooter("Not found: " + p.searchEditor.text)
 
 	case _GotoLine:
 		p.addGotoLineFooter()
 
+	case _ColonCommand:
+		p.addColonFooter()
+
+	case _SettingMark, _GoingToMark:
+		p.addMarkFooter()
+
 	case _Viewing:
 		helpText := "Press 'ESC' / 'q' to exit, '/' to search, '?' for help"
 		if p.isShowingHelp {
 			helpText = "Press 'ESC' / 'q' to exit help, '/' to search"
 		}
 
+		if message := p.getStatusMessage(); message != "" {
+			helpText = message
+		} else if problem := p.problemSummary(); problem != "" {
+			helpText = problem + ", press 'E' for details"
+		} else if p.resumeLineNumberOneBased > 0 {
+			helpText = fmt.Sprintf("Press 'r' to resume at line %s", formatNumber(uint(p.resumeLineNumberOneBased)))
+		}
+
+		if fileIndicator := p.fileIndicator(); fileIndicator != "" {
+			helpText = fileIndicator + "  " + helpText
+		}
+
 		if p.ShowStatusBar {
 			p.setFooter(statusText + spinner + "  " + helpText)
 		}
@@ -136,20 +154,20 @@ func (p *Pager) renderLines() ([]renderedLine, string, overflowState) {
 		screenOverflow = didOverflow
 	}
 
-	inputLines, readerOverflow := p.reader.GetLines(p.lineNumberOneBased(), wantedLineCount)
-	if inputLines.lines == nil {
+	inputLines := p.reader.GetLineRange(p.lineNumberOneBased(), wantedLineCount)
+	if inputLines.Lines == nil {
 		// Empty input, empty output
-		return []renderedLine{}, inputLines.statusText, didFit
+		return []renderedLine{}, inputLines.StatusText, didFit
 	}
-	if readerOverflow == didOverflow {
+	if len(inputLines.Lines) < p.reader.GetLineCount() {
 		// This is not the whole input
 		screenOverflow = didOverflow
 	}
 
 	allLines := make([]renderedLine, 0)
-	for lineIndex, line := range inputLines.lines {
+	for lineIndex, line := range inputLines.Lines {
 
-		lineNumber := inputLines.firstLineOneBased + lineIndex
+		lineNumber := inputLines.FirstLineOneBased + lineIndex
 
 		rendering, lineOverflow := p.renderLine(line, lineNumber, p.scrollPosition.internalDontTouch)
 		if lineOverflow == didOverflow {
@@ -205,13 +223,16 @@ func (p *Pager) renderLines() ([]renderedLine, string, overflowState) {
 	// Drop the lines that should go above the screen
 	allLines = allLines[firstVisibleIndex:]
 
-	if len(allLines) <= wantedLineCount {
-		// Screen has enough room for everything, return everything
-		return allLines, inputLines.statusText, screenOverflow
+	if len(allLines) > wantedLineCount {
+		screenOverflow = didOverflow
+		allLines = allLines[0:wantedLineCount]
+	}
+
+	if listing := p.currentListing(); listing != nil && len(allLines) > 0 {
+		listing.clampSelection(allLines[0].inputLineOneBased, allLines[len(allLines)-1].inputLineOneBased)
 	}
 
-	screenOverflow = didOverflow
-	return allLines[0:wantedLineCount], inputLines.statusText, screenOverflow
+	return allLines, inputLines.StatusText, screenOverflow
 }
 
 // Render one input line into one or more screen lines.
@@ -223,6 +244,12 @@ func (p *Pager) renderLines() ([]renderedLine, string, overflowState) {
 // indent, and to (optionally) render the line number.
 func (p *Pager) renderLine(line *Line, lineNumber int, scrollPosition scrollPositionInternal) ([]renderedLine, overflowState) {
 	highlighted := line.HighlightedTokens(p.linePrefix, p.searchPattern, &lineNumber)
+	if reader := asReader(p.reader); reader != nil {
+		reader.highlightChanges(highlighted.Cells, lineNumber)
+		if reader.listing != nil {
+			reader.listing.highlightSelection(highlighted.Cells, lineNumber)
+		}
+	}
 	var wrapped [][]twin.Cell
 	overflow := didFit
 	if p.WrapLongLines {
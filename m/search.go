@@ -4,24 +4,38 @@ import (
 	"fmt"
 	"regexp"
 	"unicode"
-	"unicode/utf8"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/walles/moar/twin"
 )
 
+// '/' or CTRL-r, open the search prompt
+func (p *Pager) startSearch(backwards bool) {
+	p.searchStartPosition = p.currentPosition()
+	p.initialSearchNextLine = 0
+	p.mode = _Searching
+	p.searchBackwards = backwards
+	p.searchEditor.setText("")
+	p.searchPattern = nil
+	p.searchHistoryIndex = len(p.searchHistory)
+	p.searchDraft = ""
+}
+
 func (p *Pager) addSearchFooter() {
 	width, height := p.screen.Size()
 
+	prompt := "Search: "
+	if p.searchBackwards {
+		prompt = "Search backwards: "
+	}
+
 	pos := 0
-	for _, token := range "Search: " + p.searchString {
+	for _, token := range prompt {
 		p.screen.SetCell(pos, height-1, twin.NewCell(token, twin.StyleDefault))
 		pos++
 	}
 
-	// Add a cursor
-	p.screen.SetCell(pos, height-1, twin.NewCell(' ', twin.StyleDefault.WithAttr(twin.AttrReverse)))
-	pos++
+	pos = p.searchEditor.render(p.screen, pos, height-1)
 
 	// Clear the rest of the line
 	for pos < width {
@@ -36,6 +50,22 @@ func (p *Pager) scrollToSearchHits() {
 		return
 	}
 
+	if p.searchBackwards {
+		// Search upwards from above the top of the screen, just like '?' in
+		// less. Start from where the search started, or every character typed
+		// would take us further up.
+		startPosition := NewScrollPositionFromLineNumberOneBased(
+			p.searchStartPosition.lineNumberOneBased, "scrollToSearchHits").PreviousLine(1)
+		firstHitPosition := p.findFirstHit(startPosition, true)
+		if firstHitPosition == nil {
+			// No match, give up
+			return
+		}
+
+		p.scrollPosition = *firstHitPosition
+		return
+	}
+
 	firstHitPosition := p.findFirstHit(p.scrollPosition, false)
 	if firstHitPosition == nil {
 		// No match, give up
@@ -77,6 +107,52 @@ func (p *Pager) findFirstHit(startPosition scrollPosition, backwards bool) *scro
 	}
 }
 
+// How many lines maybeScrollToInitialSearchHit() looks at per main loop pass.
+// Large inputs would make the UI unresponsive if we searched them all at once.
+const initialSearchLinesPerPass = 10_000
+
+// Scroll to the first hit of PageOptions.InitialSearch. Lines may still be
+// coming in, so we pick up where we left off every time.
+func (p *Pager) maybeScrollToInitialSearchHit() {
+	if p.initialSearchNextLine == 0 || p.searchPattern == nil {
+		return
+	}
+
+	// Check this before searching, more lines could arrive while we do
+	done := p.reader.Done()
+
+	for lineNumber := p.initialSearchNextLine; ; lineNumber++ {
+		if lineNumber-p.initialSearchNextLine >= initialSearchLinesPerPass {
+			// Let the main loop do other things, then come back here
+			p.initialSearchNextLine = lineNumber
+			select {
+			case p.screen.Events() <- eventMoreLinesAvailable{}:
+			default:
+				// The main loop has events to process anyway
+			}
+			return
+		}
+
+		line := p.reader.GetLine(lineNumber)
+		if line == nil {
+			if done {
+				// No hits, never mind
+				p.initialSearchNextLine = 0
+			} else {
+				p.initialSearchNextLine = lineNumber
+			}
+			return
+		}
+
+		if p.searchPattern.MatchString(line.Plain(&lineNumber)) {
+			p.scrollPosition = NewScrollPositionFromLineNumberOneBased(lineNumber, "maybeScrollToInitialSearchHit")
+			p.TargetLineNumberOneBased = 0
+			p.initialSearchNextLine = 0
+			return
+		}
+	}
+}
+
 func (p *Pager) scrollToNextSearchHit() {
 	if p.searchPattern == nil {
 		// Nothing to search for, never mind
@@ -159,7 +235,7 @@ func (p *Pager) scrollToPreviousSearchHit() {
 }
 
 func (p *Pager) updateSearchPattern() {
-	p.searchPattern = toPattern(p.searchString)
+	p.searchPattern = toPattern(p.searchEditor.text)
 
 	p.scrollToSearchHits()
 
@@ -208,52 +284,46 @@ func toPattern(compileMe string) *regexp.Regexp {
 	panic(err)
 }
 
-// From: https://stackoverflow.com/a/57005674/473672
-func removeLastChar(s string) string {
-	r, size := utf8.DecodeLastRuneInString(s)
-	if r == utf8.RuneError && (size == 0 || size == 1) {
-		size = 0
-	}
-	return s[:len(s)-size]
-}
-
 func (p *Pager) onSearchKey(key twin.KeyCode) {
 	switch key {
-	case twin.KeyEscape, twin.KeyEnter:
+	case twin.KeyEscape:
+		p.pushJumpIfMoved(p.searchStartPosition)
 		p.mode = _Viewing
 
-	case twin.KeyBackspace, twin.KeyDelete:
-		if len(p.searchString) == 0 {
-			return
-		}
-
-		p.searchString = removeLastChar(p.searchString)
-		p.updateSearchPattern()
+	case twin.KeyEnter:
+		p.addToSearchHistory(p.searchEditor.text)
+		p.pushJumpIfMoved(p.searchStartPosition)
+		p.mode = _Viewing
 
 	case twin.KeyUp:
-		// Clipping is done in _Redraw()
-		p.scrollPosition = p.scrollPosition.PreviousLine(1)
-		p.mode = _Viewing
+		p.previousSearchFromHistory()
 
 	case twin.KeyDown:
-		// Clipping is done in _Redraw()
-		p.scrollPosition = p.scrollPosition.NextLine(1)
-		p.mode = _Viewing
+		p.nextSearchFromHistory()
 
 	case twin.KeyPgUp:
+		p.pushJumpIfMoved(p.searchStartPosition)
 		p.scrollPosition = p.scrollPosition.PreviousLine(p.visibleHeight())
 		p.mode = _Viewing
 
 	case twin.KeyPgDown:
+		p.pushJumpIfMoved(p.searchStartPosition)
 		p.scrollPosition = p.scrollPosition.NextLine(p.visibleHeight())
 		p.mode = _Viewing
 
 	default:
-		log.Debugf("Unhandled search key event %v", key)
+		before := p.searchEditor.text
+		if !p.searchEditor.onKey(key) {
+			log.Debugf("Unhandled search key event %v", key)
+			return
+		}
+		if p.searchEditor.text != before {
+			p.updateSearchPattern()
+		}
 	}
 }
 
 func (p *Pager) onSearchRune(char rune) {
-	p.searchString = p.searchString + string(char)
+	p.searchEditor.onRune(char)
 	p.updateSearchPattern()
 }
@@ -27,8 +27,8 @@ func TestScrollToNextSearchHit_StartAtBottom(t *testing.T) {
 	pager.scrollToEnd()
 
 	// Set the search to something that doesn't exist in this pager
-	pager.searchString = "xxx"
-	pager.searchPattern = toPattern(pager.searchString)
+	pager.searchEditor.setText("xxx")
+	pager.searchPattern = toPattern(pager.searchEditor.text)
 
 	// Scroll to the next search hit
 	pager.scrollToNextSearchHit()
@@ -41,8 +41,8 @@ func TestScrollToNextSearchHit_StartAtTop(t *testing.T) {
 	pager := createThreeLinesPager(t)
 
 	// Set the search to something that doesn't exist in this pager
-	pager.searchString = "xxx"
-	pager.searchPattern = toPattern(pager.searchString)
+	pager.searchEditor.setText("xxx")
+	pager.searchPattern = toPattern(pager.searchEditor.text)
 
 	// Scroll to the next search hit
 	pager.scrollToNextSearchHit()
@@ -56,8 +56,8 @@ func TestScrollToNextSearchHit_WrapAfterNotFound(t *testing.T) {
 	pager.scrollToEnd()
 
 	// Search for "a", it's on the first line (ref createThreeLinesPager())
-	pager.searchString = "a"
-	pager.searchPattern = toPattern(pager.searchString)
+	pager.searchEditor.setText("a")
+	pager.searchPattern = toPattern(pager.searchEditor.text)
 
 	// Scroll to the next search hit, this should take us into _NotFound
 	pager.scrollToNextSearchHit()
@@ -76,8 +76,8 @@ func TestScrollToNextSearchHit_WrapAfterFound(t *testing.T) {
 	pager.scrollToEnd()
 
 	// Search for "f", it's on the last line (ref createThreeLinesPager())
-	pager.searchString = "f"
-	pager.searchPattern = toPattern(pager.searchString)
+	pager.searchEditor.setText("f")
+	pager.searchPattern = toPattern(pager.searchEditor.text)
 
 	// Scroll to the next search hit, this should take us into _NotFound
 	pager.scrollToNextSearchHit()
@@ -100,7 +100,7 @@ func Test152(t *testing.T) {
 	assert.Equal(t, _Viewing, pager.mode, "Initial pager state")
 
 	// Search for the first not-visible hit
-	pager.searchString = "abcde"
+	pager.searchEditor.setText("abcde")
 	pager.mode = _Searching
 
 	// Scroll to the next search hit
@@ -109,3 +109,60 @@ func Test152(t *testing.T) {
 	assert.Equal(t, _Searching, pager.mode)
 	assert.Equal(t, 3, pager.lineNumberOneBased())
 }
+
+func TestBackwardSearch(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+	gotoLine(pager, "60")
+
+	// CTRL-r. Hits are on lines 5, 15, 25 and so on.
+	typeRunes(pager, "\x12"+"5$")
+	pager.redraw("")
+	screen := pager.screen.(*twin.FakeScreen)
+	assert.Equal(t, rowToString(screen.GetRow(9)), "Search backwards: 5$")
+	pager.onKey(twin.KeyEnter)
+	assert.Equal(t, pager.lineNumberOneBased(), 55)
+
+	// 'n' should go on upwards
+	typeRunes(pager, "n")
+	assert.Equal(t, pager.lineNumberOneBased(), 45)
+	typeRunes(pager, "n")
+	assert.Equal(t, pager.lineNumberOneBased(), 35)
+
+	// 'N' should go back down
+	typeRunes(pager, "N")
+	assert.Equal(t, pager.lineNumberOneBased(), 45)
+}
+
+func TestBackwardSearchScrollsUp(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+	gotoLine(pager, "50")
+
+	typeRunes(pager, "\x12Line 4")
+	assert.Equal(t, pager.lineNumberOneBased(), 49)
+}
+
+// Backward searches start above the top of the screen, just like in less
+func TestBackwardSearchSkipsScreen(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+	gotoLine(pager, "50")
+
+	// Lines 50-59 are on screen
+	typeRunes(pager, "\x12Line 5")
+	assert.Equal(t, pager.lineNumberOneBased(), 5)
+}
+
+// A forward search after a backward one should make 'n' go downwards again
+func TestSearchDirectionIsRemembered(t *testing.T) {
+	pager := newGotoTestPager(t, NewReaderFromText("hundred", hundredLines()))
+	gotoLine(pager, "50")
+
+	typeRunes(pager, "\x12Line")
+	pager.onKey(twin.KeyEnter)
+	typeRunes(pager, "/Line 7")
+	pager.onKey(twin.KeyEnter)
+	assert.Equal(t, pager.lineNumberOneBased(), 70)
+
+	// Line 71 is on screen, 79 is the first hit below it
+	typeRunes(pager, "n")
+	assert.Equal(t, pager.lineNumberOneBased(), 79)
+}
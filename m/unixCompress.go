@@ -0,0 +1,221 @@
+package m
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Decompressor for files compressed with the classic Unix "compress" command,
+// usually named something.Z.
+//
+// Go's compress/lzw can't do this, since it knows about neither the header,
+// the CLEAR code nor the padding that compress adds every time the code width
+// changes. This implementation works like the one in ncompress:
+// https://github.com/vapier/ncompress
+
+const (
+	unixCompressBlockModeFlag = 0x80
+	unixCompressMaxBitsMask   = 0x1f
+
+	unixCompressInitBits = 9
+	unixCompressMaxBits  = 16
+
+	// In block mode this code means "throw away the dictionary and start
+	// over"
+	unixCompressClear = 256
+)
+
+type unixCompressReader struct {
+	source    *bufio.Reader
+	blockMode bool
+	maxBits   int
+
+	// Codes are read in groups of eight. A group is as many bytes as there
+	// are bits in a code.
+	codeBits    int
+	maxCode     int
+	group       []byte
+	groupOffset int // In bits
+	groupSize   int // In bits, only counting bits that can start a code
+	clearing    bool
+
+	// The dictionary. Codes below 256 are the bytes themselves.
+	prefixes  []uint16
+	suffixes  []byte
+	freeEntry int
+
+	// -1 before we have read the first code
+	oldCode   int
+	firstByte byte
+
+	// Decoded bytes not yet returned by Read()
+	pending []byte
+
+	// Each code decodes into a chain of bytes, starting with the last one
+	reversed []byte
+}
+
+func newUnixCompressReader(compressed io.Reader) (io.Reader, error) {
+	source := bufio.NewReader(compressed)
+
+	header := make([]byte, 3)
+	_, err := io.ReadFull(source, header)
+	if err != nil {
+		return nil, fmt.Errorf("error reading compress(1) header: %w", err)
+	}
+	if header[0] != 0x1f || header[1] != 0x9d {
+		return nil, fmt.Errorf("not compress(1) data")
+	}
+
+	maxBits := int(header[2] & unixCompressMaxBitsMask)
+	if maxBits < unixCompressInitBits || maxBits > unixCompressMaxBits {
+		return nil, fmt.Errorf("unsupported compress(1) code width: %d bits", maxBits)
+	}
+
+	blockMode := header[2]&unixCompressBlockModeFlag != 0
+	firstFree := 256
+	if blockMode {
+		// Make room for the CLEAR code
+		firstFree = unixCompressClear + 1
+	}
+
+	return &unixCompressReader{
+		source:    source,
+		blockMode: blockMode,
+		maxBits:   maxBits,
+
+		codeBits: unixCompressInitBits,
+		maxCode:  1<<unixCompressInitBits - 1,
+
+		// Two extra bytes so that reading a code never goes out of bounds
+		group: make([]byte, unixCompressMaxBits+2),
+
+		prefixes:  make([]uint16, 1<<maxBits),
+		suffixes:  make([]byte, 1<<maxBits),
+		freeEntry: firstFree,
+		oldCode:   -1,
+	}, nil
+}
+
+// Returns io.EOF when there are no more codes
+func (r *unixCompressReader) readCode() (int, error) {
+	if r.clearing || r.groupOffset >= r.groupSize || r.freeEntry > r.maxCode {
+		if r.freeEntry > r.maxCode {
+			r.codeBits++
+			if r.codeBits == r.maxBits {
+				// Codes can't get any wider, and this is larger than any
+				// code we will be adding
+				r.maxCode = 1 << r.maxBits
+			} else {
+				r.maxCode = 1<<r.codeBits - 1
+			}
+		}
+
+		if r.clearing {
+			r.codeBits = unixCompressInitBits
+			r.maxCode = 1<<r.codeBits - 1
+			r.clearing = false
+		}
+
+		// Any code size change means starting on a new group, even if we
+		// didn't use up the current one.
+		bytesRead, err := io.ReadFull(r.source, r.group[:r.codeBits])
+		if bytesRead == 0 {
+			if err == nil || err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return 0, err
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+
+		r.groupOffset = 0
+		r.groupSize = bytesRead*8 - (r.codeBits - 1)
+	}
+
+	byteIndex := r.groupOffset / 8
+	threeBytes := int(r.group[byteIndex]) |
+		int(r.group[byteIndex+1])<<8 |
+		int(r.group[byteIndex+2])<<16
+	code := (threeBytes >> (r.groupOffset % 8)) & (1<<r.codeBits - 1)
+	r.groupOffset += r.codeBits
+
+	return code, nil
+}
+
+// Decode one code into r.pending
+func (r *unixCompressReader) decodeCode() error {
+	code, err := r.readCode()
+	if err != nil {
+		return err
+	}
+
+	if r.oldCode == -1 {
+		// First code, must be a plain byte
+		if code > 255 {
+			return fmt.Errorf("corrupt compress(1) data, first code is %d", code)
+		}
+
+		r.oldCode = code
+		r.firstByte = byte(code)
+		r.pending = append(r.pending, r.firstByte)
+		return nil
+	}
+
+	if code == unixCompressClear && r.blockMode {
+		r.clearing = true
+
+		// The next code will add an entry that nobody will be using, which
+		// puts the first real entry at the right place
+		r.freeEntry = unixCompressClear
+		return nil
+	}
+
+	thisCode := code
+	r.reversed = r.reversed[:0]
+	if code >= r.freeEntry {
+		if code > r.freeEntry {
+			return fmt.Errorf("corrupt compress(1) data, code %d is beyond dictionary size %d", code, r.freeEntry)
+		}
+
+		// The code we're about to add, which is the previous code plus its
+		// own first byte
+		r.reversed = append(r.reversed, r.firstByte)
+		code = r.oldCode
+	}
+
+	for code > 255 {
+		r.reversed = append(r.reversed, r.suffixes[code])
+		code = int(r.prefixes[code])
+	}
+	r.firstByte = byte(code)
+	r.reversed = append(r.reversed, r.firstByte)
+
+	for i := len(r.reversed) - 1; i >= 0; i-- {
+		r.pending = append(r.pending, r.reversed[i])
+	}
+
+	if r.freeEntry < 1<<r.maxBits {
+		r.prefixes[r.freeEntry] = uint16(r.oldCode)
+		r.suffixes[r.freeEntry] = r.firstByte
+		r.freeEntry++
+	}
+	r.oldCode = thisCode
+
+	return nil
+}
+
+func (r *unixCompressReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		err := r.decodeCode()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	count := copy(p, r.pending)
+	r.pending = r.pending[count:]
+	return count, nil
+}
@@ -0,0 +1,161 @@
+package m
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// Compress like the Unix "compress" command would. Real compress emits a
+// CLEAR code when the dictionary is full and compression gets worse, we do it
+// as soon as the dictionary is full.
+//
+// Output verified to decompress correctly using "gzip -d".
+func unixCompress(data []byte, maxBits int) []byte {
+	out := []byte{0x1f, 0x9d, byte(unixCompressBlockModeFlag | maxBits)}
+	maxMaxCode := 1 << maxBits
+	codeBits := unixCompressInitBits
+	maxCode := 1<<codeBits - 1
+	freeEntry := unixCompressClear + 1
+
+	// Codes go in groups of eight, and the group is padded with zeros every
+	// time the code width changes
+	var buffer []byte
+	bitOffset := 0
+	output := func(code int) {
+		for i := 0; i < codeBits; i++ {
+			bit := bitOffset + i
+			for len(buffer) <= bit/8 {
+				buffer = append(buffer, 0)
+			}
+			buffer[bit/8] |= byte((code>>i)&1) << (bit % 8)
+		}
+		bitOffset += codeBits
+		if bitOffset == codeBits*8 {
+			out = append(out, buffer...)
+			buffer = buffer[:0]
+			bitOffset = 0
+		}
+
+		if freeEntry > maxCode {
+			if bitOffset > 0 {
+				for len(buffer) < codeBits {
+					buffer = append(buffer, 0)
+				}
+				out = append(out, buffer...)
+			}
+			buffer = buffer[:0]
+			bitOffset = 0
+
+			codeBits++
+			if codeBits == maxBits {
+				maxCode = maxMaxCode
+			} else {
+				maxCode = 1<<codeBits - 1
+			}
+		}
+	}
+
+	type key struct {
+		prefix int
+		suffix byte
+	}
+	table := map[key]int{}
+
+	if len(data) > 0 {
+		current := int(data[0])
+		for _, b := range data[1:] {
+			if code, found := table[key{current, b}]; found {
+				current = code
+				continue
+			}
+
+			output(current)
+			if freeEntry < maxMaxCode {
+				table[key{current, b}] = freeEntry
+				freeEntry++
+			} else {
+				output(unixCompressClear)
+
+				// Start over with a new group and narrow codes
+				if bitOffset > 0 {
+					for len(buffer) < codeBits {
+						buffer = append(buffer, 0)
+					}
+					out = append(out, buffer...)
+				}
+				buffer = buffer[:0]
+				bitOffset = 0
+				codeBits = unixCompressInitBits
+				maxCode = 1<<codeBits - 1
+				freeEntry = unixCompressClear + 1
+				table = map[key]int{}
+			}
+			current = int(b)
+		}
+		output(current)
+	}
+
+	return append(out, buffer[:(bitOffset+7)/8]...)
+}
+
+// Big and varied enough to fill up the dictionary
+func unixCompressTestText(size int) []byte {
+	plain := bytes.Buffer{}
+	for i := 0; plain.Len() < size; i++ {
+		_, _ = fmt.Fprintf(&plain, "Line %d: %x %d\n", i, i*i, i%37)
+	}
+	return plain.Bytes()
+}
+
+func TestUnixCompressRoundTrip(t *testing.T) {
+	plain := bytes.NewBuffer(unixCompressTestText(1024 * 1024))
+
+	for _, maxBits := range []int{12, 16} {
+		compressed := unixCompress(plain.Bytes(), maxBits)
+
+		reader, err := newUnixCompressReader(bytes.NewReader(compressed))
+		assert.NilError(t, err)
+
+		decompressed, err := io.ReadAll(reader)
+		assert.NilError(t, err)
+		assert.Assert(t, bytes.Equal(decompressed, plain.Bytes()), "maxBits=%d", maxBits)
+	}
+}
+
+func TestUnixCompressEmpty(t *testing.T) {
+	reader, err := newUnixCompressReader(bytes.NewReader(unixCompress(nil, 16)))
+	assert.NilError(t, err)
+
+	decompressed, err := io.ReadAll(reader)
+	assert.NilError(t, err)
+	assert.Equal(t, len(decompressed), 0)
+}
+
+func TestUnixCompressCorrupt(t *testing.T) {
+	// First code must be a plain byte, but this one is 0x1ff
+	reader, err := newUnixCompressReader(bytes.NewReader([]byte{0x1f, 0x9d, 0x90, 0xff, 0x01}))
+	assert.NilError(t, err)
+
+	_, err = io.ReadAll(reader)
+	assert.ErrorContains(t, err, "corrupt")
+}
+
+// sample-files/compressed-clear.txt.Z has 100kB of unixCompressTestText()
+// compressed using 12 bit codes, so the dictionary fills up and gets cleared
+// a number of times. Verified using "gzip -dc".
+func TestUnixCompressClearCodes(t *testing.T) {
+	compressed, err := os.ReadFile(getSamplesDir() + "/compressed-clear.txt.Z")
+	assert.NilError(t, err)
+
+	reader, err := newUnixCompressReader(bytes.NewReader(compressed))
+	assert.NilError(t, err)
+
+	decompressed, err := io.ReadAll(reader)
+	assert.NilError(t, err)
+	assert.Assert(t, bytes.Equal(decompressed, unixCompressTestText(100*1024)))
+}
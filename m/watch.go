@@ -0,0 +1,70 @@
+package m
+
+import (
+	"time"
+
+	"github.com/walles/moar/twin"
+)
+
+// Sent by the timer started in StartPaging() when it's time to run our
+// command again, see Pager.ReloadInterval
+type eventReloadTimer struct{}
+
+// Ask the main loop to reload the current input every p.ReloadInterval
+func (p *Pager) reloadPeriodically() {
+	screen := p.screen
+	interval := p.ReloadInterval
+
+	go func() {
+		for {
+			time.Sleep(interval)
+			screen.Events() <- eventReloadTimer{}
+		}
+	}()
+}
+
+// The new run of our shell command is done, show its output instead of the
+// old one. Unlike when reloading files, we keep our scroll position as it is.
+func (p *Pager) finishRerun(previousRun *Reader, newReader *Reader) {
+	// Only keep one previous run around, not all of them
+	previousRun.Lock()
+	previousRun.previousRun = nil
+	previousRun.Unlock()
+
+	newReader.Lock()
+	newReader.previousRun = previousRun
+	newReader.Unlock()
+
+	p.replaceReader(previousRun, newReader)
+}
+
+// What changed since the previous run of our command looks like this. Search
+// hits are shown in reverse video, so changes must look different.
+const changedAttrs = twin.AttrBold | twin.AttrUnderline
+
+// Highlight the parts of a line that changed since the previous run of our
+// shell command, like "watch --differences" does.
+func (reader *Reader) highlightChanges(cells []twin.Cell, lineNumberOneBased int) {
+	reader.Lock()
+	previousRun := reader.previousRun
+	reader.Unlock()
+	if previousRun == nil {
+		return
+	}
+
+	var previous []rune
+	previousLine := previousRun.GetLine(lineNumberOneBased)
+	if previousLine != nil {
+		previous = []rune(previousLine.Plain(&lineNumberOneBased))
+	}
+
+	// Cells and plain text runes match up one to one, see
+	// Line.HighlightedTokens()
+	for i := range cells {
+		if i < len(previous) && previous[i] == cells[i].Rune {
+			continue
+		}
+
+		cells[i].Style = cells[i].Style.WithAttr(changedAttrs)
+	}
+}
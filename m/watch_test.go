@@ -0,0 +1,86 @@
+package m
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/walles/moar/twin"
+	"gotest.tools/v3/assert"
+)
+
+func TestRerunShellCommand(t *testing.T) {
+	filename := t.TempDir() + "/output.txt"
+	assert.NilError(t, os.WriteFile(filename, []byte(strings.Repeat("unchanged\n", 20)+"count: 1\n"), 0o600))
+
+	reader, err := NewReaderFromShellCommand("cat " + filename)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+	assert.Equal(t, *reader.name, "cat "+filename)
+
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+	pager.scrollPosition = NewScrollPositionFromLineNumberOneBased(5, "TestRerunShellCommand")
+
+	assert.NilError(t, os.WriteFile(filename, []byte(strings.Repeat("unchanged\n", 20)+"count: 2\nnew\n"), 0o600))
+	pager.onRune('R')
+
+	// The old output should be shown until the new run is done
+	assert.Equal(t, pager.reader, reader)
+	assert.Assert(t, pager.reloading != nil)
+	assert.NilError(t, pager.reloading.reader._wait())
+	assert.Assert(t, !reader.stopped.Load())
+
+	pager.maybeReportReload()
+	assert.Assert(t, pager.reader != reader)
+	assert.Assert(t, reader.stopped.Load())
+	assert.Equal(t, pager.files[0].reader, pager.reader)
+	assert.Equal(t, pager.reader.GetLineCount(), 22)
+	assert.Equal(t, pager.lineNumberOneBased(), 5)
+	assert.Equal(t, pager.getStatusMessage(), "Reloaded, 1 line added")
+
+	// Only what changed should be highlighted
+	pager.scrollPosition = NewScrollPositionFromLineNumberOneBased(14, "TestRerunShellCommand")
+	pager.redraw("")
+	screen := pager.screen.(*twin.FakeScreen)
+	assert.Equal(t, rowToString(screen.GetRow(7)), " 21 count: 2")
+	changed := twin.StyleDefault.WithAttr(changedAttrs)
+	row := screen.GetRow(7)
+	for i := len(" 21 "); i < len(rowToString(row)); i++ {
+		if i == len(" 21 count: ") {
+			assert.Equal(t, row[i].Style, changed)
+		} else {
+			assert.Equal(t, row[i].Style, twin.StyleDefault, "column %d", i)
+		}
+	}
+	assert.Equal(t, screen.GetRow(8)[5].Style, changed)
+	assert.Equal(t, screen.GetRow(6)[5].Style, twin.StyleDefault)
+
+	// Changed search hits should look different from unchanged ones
+	pager.searchPattern = toPattern("n")
+	pager.redraw("")
+	assert.Equal(t, rowToString(screen.GetRow(8)), " 22 new")
+	assert.Equal(t, rowToString(screen.GetRow(6)), " 20 unchanged")
+	assert.Assert(t, screen.GetRow(8)[len(" 22 ")].Style != screen.GetRow(6)[len(" 20 u")].Style)
+}
+
+func TestRerunShellCommandStillRunning(t *testing.T) {
+	scriptname := t.TempDir() + "/script.sh"
+	assert.NilError(t, os.WriteFile(scriptname, []byte("echo first\n"), 0o600))
+
+	reader, err := NewReaderFromShellCommand("sh " + scriptname)
+	assert.NilError(t, err)
+	assert.NilError(t, reader._wait())
+
+	pager := NewPager(reader)
+	pager.screen = twin.NewFakeScreen(80, 10)
+
+	assert.NilError(t, os.WriteFile(scriptname, []byte("sleep 0.3; echo second\n"), 0o600))
+	pager.onRune('R')
+	pager.onRune('R')
+	assert.Equal(t, pager.getStatusMessage(), "Still running: sh "+scriptname)
+
+	assert.NilError(t, pager.reloading.reader._wait())
+	pager.maybeReportReload()
+	assert.Equal(t, pager.reader.GetLine(1).Plain(nil), "second")
+}
@@ -19,6 +19,8 @@ import (
 	"github.com/alecthomas/chroma/v2/styles"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/term"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
 
 	"github.com/walles/moar/m"
 	"github.com/walles/moar/twin"
@@ -52,12 +54,13 @@ func printUsage(output io.Writer, flagSet *flag.FlagSet, printCommandline bool)
 	}
 
 	_, _ = fmt.Fprintln(output, "Usage:")
-	_, _ = fmt.Fprintln(output, "  moar [options] <file>")
+	_, _ = fmt.Fprintln(output, "  moar [options] <file> ...")
 	_, _ = fmt.Fprintln(output, "  ... | moar")
 	_, _ = fmt.Fprintln(output, "  moar < file")
 	_, _ = fmt.Fprintln(output)
 	_, _ = fmt.Fprintln(output, "Shows file contents. Compressed files will be transparently decompressed.")
-	_, _ = fmt.Fprintln(output, "Input is expected to be (possibly compressed) UTF-8 encoded text. Invalid /")
+	_, _ = fmt.Fprintln(output, "Input is expected to be (possibly compressed) UTF-8 encoded text. UTF-16 and")
+	_, _ = fmt.Fprintln(output, "Latin-1 are detected and converted, or use --encoding. Invalid /")
 	_, _ = fmt.Fprintln(output, "non-printable characters are by default rendered as '?'.")
 	_, _ = fmt.Fprintln(output)
 	_, _ = fmt.Fprintln(output, "More information + source code:")
@@ -75,6 +78,8 @@ func printUsage(output io.Writer, flagSet *flag.FlagSet, printCommandline bool)
 	printUsageEnvVar(output, "LESS_TERMCAP_md", "man page bold style")
 	printUsageEnvVar(output, "LESS_TERMCAP_us", "man page underline style")
 	printUsageEnvVar(output, "LESS_TERMCAP_so", "search hits and footer style")
+	printUsageEnvVar(output, "LESSOPEN", "input preprocessor")
+	printUsageEnvVar(output, "LESSCLOSE", "input postprocessor")
 
 	absMoarPath, err := absLookPath(os.Args[0])
 	if err == nil {
@@ -174,6 +179,16 @@ func parseLexerOption(lexerOption string) (chroma.Lexer, error) {
 	)
 }
 
+func parseEncodingOption(encodingOption string) (encoding.Encoding, error) {
+	enc, err := htmlindex.Get(encodingOption)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"Valid encodings are for example utf-8, utf-16le, utf-16be and iso-8859-1. Full list: https://encoding.spec.whatwg.org/#names-and-labels")
+	}
+
+	return enc, nil
+}
+
 func parseStyleOption(styleOption string) (chroma.Style, error) {
 	style, ok := styles.Registry[styleOption]
 	if !ok {
@@ -259,6 +274,19 @@ func parseShiftAmount(shiftAmount string) (uint, error) {
 	return uint(value), nil
 }
 
+func parseEveryOption(every string) (time.Duration, error) {
+	value, err := time.ParseDuration(every)
+	if err != nil {
+		return 0, err
+	}
+
+	if value <= 0 {
+		return 0, fmt.Errorf("Interval must be positive")
+	}
+
+	return value, nil
+}
+
 func parseMouseMode(mouseMode string) (twin.MouseMode, error) {
 	switch mouseMode {
 	case "auto":
@@ -272,19 +300,20 @@ func parseMouseMode(mouseMode string) (twin.MouseMode, error) {
 	return twin.MouseModeAuto, fmt.Errorf("Valid modes are auto, select and scroll")
 }
 
-func pumpToStdout(inputFilename *string) error {
-	if inputFilename != nil {
-		// If we get both redirected stdin and an input filename, we must prefer
-		// to copy the file, because that's how less works. That's why we go for
-		// the filename first.
-		inputFile, err := os.Open(*inputFilename)
-		if err != nil {
-			return fmt.Errorf("Failed to open %s: %w", *inputFilename, err)
-		}
+func pumpToStdout(inputFilenames []string, execCommand string) error {
+	if execCommand != "" {
+		return pumpCommandToStdout(execCommand)
+	}
 
-		_, err = io.Copy(os.Stdout, inputFile)
-		if err != nil {
-			return fmt.Errorf("Failed to copy %s to stdout: %w", *inputFilename, err)
+	if len(inputFilenames) > 0 {
+		// If we get both redirected stdin and input filenames, we must prefer
+		// to copy the files, because that's how less works. That's why we go
+		// for the filenames first.
+		for _, inputFilename := range inputFilenames {
+			err := pumpFileToStdout(inputFilename)
+			if err != nil {
+				return err
+			}
 		}
 		return nil
 	}
@@ -298,6 +327,35 @@ func pumpToStdout(inputFilename *string) error {
 	return nil
 }
 
+// Like m.NewReaderFromShellCommand(), but with the output going straight to
+// our stdout
+func pumpCommandToStdout(command string) error {
+	cmd := m.ShellCommand(command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("Failed to run <%s>: %w", command, err)
+	}
+	return nil
+}
+
+func pumpFileToStdout(inputFilename string) error {
+	inputFile, err := os.Open(inputFilename)
+	if err != nil {
+		return fmt.Errorf("Failed to open %s: %w", inputFilename, err)
+	}
+	defer func() {
+		_ = inputFile.Close()
+	}()
+
+	_, err = io.Copy(os.Stdout, inputFile)
+	if err != nil {
+		return fmt.Errorf("Failed to copy %s to stdout: %w", inputFilename, err)
+	}
+	return nil
+}
+
 // Duplicate of m/reader.go:tryOpen
 func tryOpen(filename string) error {
 	// Try opening the file
@@ -306,6 +364,21 @@ func tryOpen(filename string) error {
 		return err
 	}
 
+	// Directories get listed, check that we can do that
+	info, err := tryMe.Stat()
+	if err == nil && info.IsDir() {
+		_, err = tryMe.ReadDir(1)
+		if err == io.EOF {
+			// Empty directory, this is fine
+			err = nil
+		}
+		closeErr := tryMe.Close()
+		if err == nil {
+			err = closeErr
+		}
+		return err
+	}
+
 	// Try reading a byte
 	buffer := make([]byte, 1)
 	_, err = tryMe.Read(buffer)
@@ -395,13 +468,16 @@ func main() {
 	trace := flagSet.Bool("trace", false, "Print trace logs after exiting")
 
 	wrap := flagSet.Bool("wrap", false, "Wrap long lines")
-	follow := flagSet.Bool("follow", false, "Follow piped input just like \"tail -f\"")
+	follow := flagSet.Bool("follow", false, "Follow piped input or growing files just like \"tail -f\"")
 	style := flagSetFunc(flagSet,
 		"style", *styles.Registry["native"],
 		"Highlighting style from https://xyproto.github.io/splash/docs/longer/all.html", parseStyleOption)
 	lexer := flagSetFunc(flagSet,
 		"lang", nil,
 		"File contents, used for highlighting. Mime type or file extension (\"html\"). Default is to guess by filename.", parseLexerOption)
+	inputEncoding := flagSetFunc(flagSet,
+		"encoding", nil,
+		"Input encoding, like \"utf-16le\" or \"iso-8859-1\". Default is to guess by contents.", parseEncodingOption)
 
 	defaultFormatter, err := parseColorsOption("auto")
 	if err != nil {
@@ -414,10 +490,13 @@ func main() {
 	noStatusBar := flagSet.Bool("no-statusbar", false, "Hide the status bar, toggle with '='")
 	quitIfOneScreen := flagSet.Bool("quit-if-one-screen", false, "Don't page if contents fits on one screen")
 	noClearOnExit := flagSet.Bool("no-clear-on-exit", false, "Retain screen contents when exiting moar")
+	noHistory := flagSet.Bool("no-history", false, "Don't remember searches and file positions between sessions")
 	statusBarStyle := flagSetFunc(flagSet, "statusbar", m.STATUSBAR_STYLE_INVERSE,
 		"Status bar style: inverse, plain or bold", parseStatusBarStyle)
 	unprintableStyle := flagSetFunc(flagSet, "render-unprintable", m.UNPRINTABLE_STYLE_HIGHLIGHT,
 		"How unprintable characters are rendered: highlight or whitespace", parseUnprintableStyle)
+	rawCarriageReturns := flagSet.Bool("raw-carriage-returns", false,
+		"Show carriage returns as unprintable characters rather than letting them overwrite the line")
 	scrollLeftHint := flagSetFunc(flagSet, "scroll-left-hint",
 		twin.NewCell('<', twin.StyleDefault.WithAttr(twin.AttrReverse)),
 		"Shown when view can scroll left. One character with optional ANSI highlighting.", parseScrollHint)
@@ -425,6 +504,9 @@ func main() {
 		twin.NewCell('>', twin.StyleDefault.WithAttr(twin.AttrReverse)),
 		"Shown when view can scroll right. One character with optional ANSI highlighting.", parseScrollHint)
 	shift := flagSetFunc(flagSet, "shift", 16, "Horizontal scroll amount >=1, defaults to 16", parseShiftAmount)
+	execCommand := flagSet.String("exec", "", "Page the output of this shell command, press 'R' to run it again")
+	every := flagSetFunc(flagSet, "every", 0,
+		"Together with --exec, run the command again this often, like \"2s\"", parseEveryOption)
 	mouseMode := flagSetFunc(
 		flagSet,
 		"mousemode",
@@ -474,31 +556,30 @@ func main() {
 		TimestampFormat: time.StampMicro,
 	})
 
-	if len(flagSet.Args()) > 1 {
-		fmt.Fprintln(os.Stderr, "ERROR: Expected exactly one filename, or data piped from stdin, got:", flagSet.Args())
-		fmt.Fprintln(os.Stderr)
-		printUsage(os.Stderr, flagSet, true)
-
-		os.Exit(1)
-	}
-
 	stdinIsRedirected := !term.IsTerminal(int(os.Stdin.Fd()))
 	stdoutIsRedirected := !term.IsTerminal(int(os.Stdout.Fd()))
-	var inputFilename *string
-	if len(flagSet.Args()) == 1 {
-		word := flagSet.Args()[0]
-		inputFilename = &word
-
+	inputFilenames := flagSet.Args()
+	for _, inputFilename := range inputFilenames {
 		// Need to check before twin.NewScreen() below, otherwise the screen
 		// will be cleared before we print the "No such file" error.
-		err := tryOpen(*inputFilename)
+		err := tryOpen(inputFilename)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "ERROR:", err)
 			os.Exit(1)
 		}
 	}
 
-	if inputFilename == nil && !stdinIsRedirected {
+	if *every > 0 && *execCommand == "" {
+		fmt.Fprintln(os.Stderr, "ERROR: --every requires --exec")
+		os.Exit(1)
+	}
+
+	if *execCommand != "" && len(inputFilenames) > 0 {
+		fmt.Fprintln(os.Stderr, "ERROR: Either use --exec or give input files, not both")
+		os.Exit(1)
+	}
+
+	if len(inputFilenames) == 0 && !stdinIsRedirected && *execCommand == "" {
 		fmt.Fprintln(os.Stderr, "ERROR: Filename or input pipe required")
 		fmt.Fprintln(os.Stderr)
 		printUsage(os.Stderr, flagSet, true)
@@ -506,7 +587,7 @@ func main() {
 	}
 
 	if stdoutIsRedirected {
-		err := pumpToStdout(inputFilename)
+		err := pumpToStdout(inputFilenames, *execCommand)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "ERROR:", err)
 			os.Exit(1)
@@ -525,7 +606,7 @@ func main() {
 	if err != nil {
 		// Ref: https://github.com/walles/moar/issues/149
 		log.Debug("Failed to set up screen for paging, pumping to stdout instead: ", err)
-		err := pumpToStdout(inputFilename)
+		err := pumpToStdout(inputFilenames, *execCommand)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "ERROR:", err)
 			os.Exit(1)
@@ -542,20 +623,36 @@ func main() {
 		formatter = formatters.TTY
 	}
 
-	var reader *m.Reader
-	if stdinIsRedirected {
+	var pager *m.Pager
+	if *execCommand != "" {
+		reader, err := m.NewReaderFromShellCommand(*execCommand)
+		if err != nil {
+			screen.Close()
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			os.Exit(1)
+		}
+		pager = m.NewPager(reader)
+	} else if stdinIsRedirected {
 		// Display input pipe contents
-		reader = m.NewReaderFromStream("", os.Stdin, *style, formatter, *lexer)
+		pager = m.NewPager(m.NewReaderFromStreamWithOptions("", os.Stdin, *style, formatter, *lexer, m.ReaderOptions{Encoding: *inputEncoding}))
 	} else {
-		// Display the input file contents
-		reader, err = m.NewReaderFromFilename(*inputFilename, *style, formatter, *lexer)
+		// Display the input files contents. Files after the first one are
+		// opened when the user switches to them.
+		pager, err = m.NewPagerFromFilenames(inputFilenames, func(filename string) (*m.Reader, error) {
+			return m.NewReaderFromFilenameWithOptions(filename, *style, formatter, *lexer, m.ReaderOptions{
+				Follow:    *follow,
+				LessOpen:  os.Getenv("LESSOPEN"),
+				LessClose: os.Getenv("LESSCLOSE"),
+				Encoding:  *inputEncoding,
+			})
+		})
 		if err != nil {
+			screen.Close()
 			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
 			os.Exit(1)
 		}
 	}
 
-	pager := m.NewPager(reader)
 	pager.WrapLongLines = *wrap
 	pager.ShowLineNumbers = !*noLineNumbers
 	pager.ShowStatusBar = !*noStatusBar
@@ -563,9 +660,14 @@ func main() {
 	pager.QuitIfOneScreen = *quitIfOneScreen
 	pager.StatusBarStyle = *statusBarStyle
 	pager.UnprintableStyle = *unprintableStyle
+	pager.RawCarriageReturns = *rawCarriageReturns
 	pager.ScrollLeftHint = *scrollLeftHint
 	pager.ScrollRightHint = *scrollRightHint
 	pager.SideScrollAmount = int(*shift)
+	pager.ReloadInterval = *every
+	if !*noHistory {
+		pager.StateFile = m.DefaultStateFile()
+	}
 
 	pager.TargetLineNumberOneBased = targetLineNumberOneBased
 	if *follow && pager.TargetLineNumberOneBased == 0 {
@@ -25,6 +25,12 @@ type EventMouse struct {
 	buttons MouseButtonMask
 }
 
+// Text pasted into the terminal. Requires bracketed paste mode, which is
+// enabled by NewScreen().
+type EventPaste struct {
+	text string
+}
+
 // After you get this, query Screen.Size() to get the new size
 type EventResize struct {
 	// This interface intentionally left blank
@@ -49,3 +55,7 @@ func (eventKeyCode *EventKeyCode) KeyCode() KeyCode {
 func (eventMouse *EventMouse) Buttons() MouseButtonMask {
 	return eventMouse.buttons
 }
+
+func (eventPaste *EventPaste) Text() string {
+	return eventPaste.text
+}
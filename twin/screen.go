@@ -96,6 +96,16 @@ type UnixScreen struct {
 // * "M" marks the end of the mouse event.
 var mouseEventRegex = regexp.MustCompile("^\x1b\\[<([0-9]+);([0-9]+);([0-9]+)M")
 
+// In bracketed paste mode, the terminal surrounds pasted text with these.
+//
+// Ref: https://invisible-island.net/xterm/xterm-paste64.html
+const pasteStart = "\x1b[200~"
+const pasteEnd = "\x1b[201~"
+
+// If we get this much pasted text without any pasteEnd, we give up waiting for
+// it and treat the input as if it had been typed.
+var maxIncompletePasteLength = 1024 * 1024
+
 // NewScreen() requires Close() to be called after you are done with your new
 // screen, most likely somewhere in your shutdown code.
 func NewScreen() (Screen, error) {
@@ -150,6 +160,7 @@ func NewScreenWithMouseModeAndColorType(mouseMode MouseMode, terminalColorCount
 		panic(fmt.Errorf("unknown mouse mode: %d", mouseMode))
 	}
 
+	screen.enableBracketedPaste(true)
 	screen.hideCursor(true)
 
 	go screen.mainLoop()
@@ -161,6 +172,7 @@ func NewScreenWithMouseModeAndColorType(mouseMode MouseMode, terminalColorCount
 // with the screen returned by NewScreen()
 func (screen *UnixScreen) Close() {
 	screen.hideCursor(false)
+	screen.enableBracketedPaste(false)
 	screen.enableMouseTracking(false)
 	screen.setAlternateScreenMode(false)
 
@@ -282,6 +294,16 @@ func (screen *UnixScreen) enableMouseTracking(enable bool) {
 	}
 }
 
+// Without bracketed paste, pasted text would arrive as individual key presses
+// and be interpreted as commands.
+func (screen *UnixScreen) enableBracketedPaste(enable bool) {
+	if enable {
+		screen.write("\x1b[?2004h")
+	} else {
+		screen.write("\x1b[?2004l")
+	}
+}
+
 // ShowCursorAt() moves the cursor to the given screen position and makes sure
 // it is visible.
 //
@@ -320,6 +342,9 @@ func (screen *UnixScreen) mainLoop() {
 	buffer := make([]byte, 1400)
 
 	maxBytesRead := 0
+
+	// Incomplete pastes and characters are kept here until the rest arrives
+	unconsumed := ""
 	for {
 		count, err := screen.ttyIn.Read(buffer)
 		if err != nil {
@@ -339,24 +364,12 @@ func (screen *UnixScreen) mainLoop() {
 			log.Trace("ttyin high watermark bumped to ", maxBytesRead, " bytes")
 		}
 
-		encodedKeyCodeSequences := string(buffer[0:count])
-		if !utf8.ValidString(encodedKeyCodeSequences) {
-			log.Warn("Got invalid UTF-8 sequence on ttyin: ", encodedKeyCodeSequences)
-			continue
-		}
-
-		for len(encodedKeyCodeSequences) > 0 {
-			var event *Event
-			event, encodedKeyCodeSequences = consumeEncodedEvent(encodedKeyCodeSequences)
-
-			if event == nil {
-				// No event, go wait for more
-				break
-			}
-
+		var events []Event
+		events, unconsumed = consumeInput(unconsumed + string(buffer[0:count]))
+		for _, event := range events {
 			// Post the event
 			select {
-			case screen.events <- *event:
+			case screen.events <- event:
 				// Yay
 			default:
 				// If this happens, consider increasing the channel size in
@@ -367,6 +380,52 @@ func (screen *UnixScreen) mainLoop() {
 	}
 }
 
+// Consume all complete events from the input.
+//
+// Returns the events, and the remainder of the input that should be prepended
+// to the next input.
+func consumeInput(encodedKeyCodeSequences string) ([]Event, string) {
+	// A multibyte character can be split between two reads, keep the start of
+	// it until the rest arrives
+	incomplete := ""
+	for i := len(encodedKeyCodeSequences) - 1; i >= 0 && i > len(encodedKeyCodeSequences)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(encodedKeyCodeSequences[i]) {
+			continue
+		}
+		if !utf8.FullRuneInString(encodedKeyCodeSequences[i:]) {
+			incomplete = encodedKeyCodeSequences[i:]
+			encodedKeyCodeSequences = encodedKeyCodeSequences[:i]
+		}
+		break
+	}
+
+	if !utf8.ValidString(encodedKeyCodeSequences) {
+		log.Warn("Got invalid UTF-8 sequence on ttyin: ", encodedKeyCodeSequences)
+		return nil, incomplete
+	}
+
+	events := []Event{}
+	for len(encodedKeyCodeSequences) > 0 {
+		var event *Event
+		event, encodedKeyCodeSequences = consumeEncodedEvent(encodedKeyCodeSequences)
+		if event != nil {
+			events = append(events, *event)
+			continue
+		}
+
+		if strings.HasPrefix(encodedKeyCodeSequences, pasteStart) && len(encodedKeyCodeSequences) > maxIncompletePasteLength {
+			log.Warn("Paste end marker missing after ", len(encodedKeyCodeSequences), " bytes, treating the paste as typed input")
+			encodedKeyCodeSequences = strings.TrimPrefix(encodedKeyCodeSequences, pasteStart)
+			continue
+		}
+
+		// No event, go wait for more
+		break
+	}
+
+	return events, encodedKeyCodeSequences + incomplete
+}
+
 // Turn ESC into <0x1b> and other low ASCII characters into <0xXX> for logging
 // purposes.
 func humanizeLowASCII(withLowAsciis string) string {
@@ -384,8 +443,20 @@ func humanizeLowASCII(withLowAsciis string) string {
 // Consume initial key code from the sequence of encoded keycodes.
 //
 // Returns a (possibly nil) event that should be posted, and the remainder of
-// the encoded events sequence.
+// the encoded events sequence. If the event is nil and the remainder isn't
+// empty, the remainder should be prepended to the next input.
 func consumeEncodedEvent(encodedEventSequences string) (*Event, string) {
+	if strings.HasPrefix(encodedEventSequences, pasteStart) {
+		pasted, remainder, found := strings.Cut(strings.TrimPrefix(encodedEventSequences, pasteStart), pasteEnd)
+		if !found {
+			// The rest of the paste hasn't arrived yet
+			return nil, encodedEventSequences
+		}
+
+		var event Event = EventPaste{text: pasted}
+		return &event, remainder
+	}
+
 	for singleKeyCodeSequence, keyCode := range escapeSequenceToKeyCode {
 		if !strings.HasPrefix(encodedEventSequences, singleKeyCodeSequence) {
 			continue
@@ -37,6 +37,64 @@ func TestConsumeEncodedEvent(t *testing.T) {
 	assertEncode(t, "1234", EventRune{rune: '1'}, "234")
 }
 
+func TestConsumeEncodedEventPaste(t *testing.T) {
+	assertEncode(t, "\x1b[200~hello\rworld\x1b[201~x",
+		EventPaste{text: "hello\rworld"}, "x")
+
+	// Escape sequences inside of pastes are not key presses
+	assertEncode(t, "\x1b[200~\x1b[A\x1b[201~",
+		EventPaste{text: "\x1b[A"}, "")
+}
+
+// Long pastes can be split over multiple reads, wait for the end
+func TestConsumeEncodedEventIncompletePaste(t *testing.T) {
+	event, remainder := consumeEncodedEvent("\x1b[200~hello")
+	assert.Assert(t, event == nil)
+	assert.Equal(t, remainder, "\x1b[200~hello")
+}
+
+func assertEvents(t *testing.T, actual []Event, expected ...Event) {
+	assert.Equal(t, len(actual), len(expected), "%#v", actual)
+	for i := range expected {
+		assert.Equal(t, actual[i], expected[i])
+	}
+}
+
+// A paste split in the middle of a multibyte character should still end up as
+// one paste
+func TestConsumeInputSplitCharacter(t *testing.T) {
+	input := pasteStart + "Hej då" + pasteEnd + "x"
+	split := strings.Index(input, "å") + 1
+
+	events, remainder := consumeInput(input[:split])
+	assert.Equal(t, len(events), 0)
+	assert.Equal(t, remainder, input[:split])
+
+	events, remainder = consumeInput(remainder + input[split:])
+	assertEvents(t, events, EventPaste{text: "Hej då"}, EventRune{rune: 'x'})
+	assert.Equal(t, remainder, "")
+
+	// Outside of pastes as well
+	events, remainder = consumeInput("ab\xc3")
+	assertEvents(t, events, EventRune{rune: 'a'}, EventRune{rune: 'b'})
+	assert.Equal(t, remainder, "\xc3")
+}
+
+// If the end of a paste never shows up, we shouldn't wait for it forever
+func TestConsumeInputMissingPasteEnd(t *testing.T) {
+	defer func(maxLength int) { maxIncompletePasteLength = maxLength }(maxIncompletePasteLength)
+	maxIncompletePasteLength = len(pasteStart) + 3
+
+	events, remainder := consumeInput(pasteStart + "abc")
+	assert.Equal(t, len(events), 0)
+	assert.Equal(t, remainder, pasteStart+"abc")
+
+	events, remainder = consumeInput(remainder + "d")
+	assertEvents(t, events,
+		EventRune{rune: 'a'}, EventRune{rune: 'b'}, EventRune{rune: 'c'}, EventRune{rune: 'd'})
+	assert.Equal(t, remainder, "")
+}
+
 func TestConsumeEncodedEventWithUnsupportedEscapeCode(t *testing.T) {
 	event, remainder := consumeEncodedEvent("\x1bXXXXX")
 	assert.Assert(t, event == nil)